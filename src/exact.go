@@ -0,0 +1,95 @@
+/*
+
+Exact solution of small instances (see tsp/exact.go): a dynamic programme over
+subsets for up to 20 cities, branch and bound on the Held-Karp 1-tree for larger.
+The optimal route is written in the same format as search/explore, for ground
+truth on e.g. the polygon and random examples of runtests and search.
+
+Build with make.
+
+Run with:
+
+./bin/exact -h
+
+./bin/exact -poly 20 -pr
+./bin/exact -dat ./data/eil51.tsp -tour ./data/eil51.opt.tour
+
+// compare annealing against the optimum
+./bin/search -dat ./data/eil51.tsp -opt ./data/eil51.opt.tour
+
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+func main() {
+
+	// variables
+	var dataFile, outFile, tourFile string
+	var method, metricName string
+	var poly int
+	var npoints int = 0
+	var pr bool
+
+	// cmd line arguments
+	flag.StringVar(&dataFile, "dat", "", "cities file (CSV or TSPLIB)")
+	flag.StringVar(&outFile, "out", "route.txt", "output file")
+	flag.StringVar(&tourFile, "tour", "", "output TSPLIB tour file (option)")
+	flag.StringVar(&metricName, "metric", "", "distance metric (default: file's, else euclid)")
+	flag.IntVar(&poly, "poly", 0, "polygon size (option)")
+	flag.StringVar(&method, "method", "auto", "exact method: dp (dynamic programme, up to 20 cities), bb (branch and bound) or auto")
+	flag.BoolVar(&pr, "pr", false, "print route")
+	flag.Parse()
+
+	// initialise TSP problem
+	var prob tspProblem
+	if dataFile != "" {
+		var err error
+		prob, err = readProblem(dataFile, metricName)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		npoints = prob.dist.size()
+	} else if poly > 0 {
+		prob = makePolygon(poly)
+		npoints = poly
+		if metricName != "" {
+			if err := prob.setMetric(metricName); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+	}
+	if npoints == 0 {
+		fmt.Println("No problem to process")
+		return
+	}
+
+	// solve
+	start := time.Now()
+	route, err := exactTour(method, prob)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	runtime := time.Since(start)
+
+	// report results
+	if pr {
+		printRoute(route, prob.labels, isOpen(prob.dist))
+	}
+	writePerm(route, "./data/"+outFile)
+	fmt.Printf("Optimal distance %v (%s) in time %v (metric %s)\n",
+		travelDist(route, prob.dist), method, runtime, prob.metric)
+	fmt.Printf("Optimal route written to %s\n", "./data/"+outFile)
+	if tourFile != "" {
+		writeTour(route, tourFile)
+		fmt.Printf("Optimal tour written to %s\n", tourFile)
+	}
+}
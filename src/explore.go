@@ -35,6 +35,12 @@ EXAMPLES:
 // 10,000-gon
 ./bin/explore -poly 10000 -temp 1.0 -per 20000 -nw 8 -nj 100 -v -d 10k-gon-T1.csv
 
+// parallel tempering: 8 replicas on a ladder from -temp down to -tf (auto by default),
+// exchanging states between neighbouring temperatures after each period
+./bin/explore -f ./data/gb_cities.csv -pt geo -nw 8 -nj 200 -per 5000 -d ./data/gb_pt.csv
+// -pt adapt re-spreads the ladder to equalise exchange rates; the diagnostics file has
+// extra columns rung (0 the hottest) and exchanged (0/1) tracing the replicas
+
 
 */
 
@@ -44,7 +50,6 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
-	"math/rand"
 	"os"
 	"sync"
 )
@@ -52,26 +57,56 @@ import (
 func main() {
 
 	// variables
-	var dataFile, diagFile, routeFile string
-	var moveclass string
-	var temp, cooling float64
-	var poly, numWalkers, numJobs int
+	var dataFile, diagFile, routeFile, tourFile, optFile string
+	var moveclass, moveweights, adapt, schedule, metricName, ladder string
+	var temp, cooling, tempFinal, alpha, beta, lambda float64
+	var chi0, chiF, acc0, acc1, gain float64
+	var rule, polish, initName string
+	var rain, deviation float64
+	var poly, numWalkers, numJobs, nn, lbIters int
 	var period, srate int
 	var npoints int = 0
-	var verbose, pr bool
+	var verbose, pr, open bool
+	var startCity, endCity string
 
 	// cmd line arguments
-	flag.StringVar(&dataFile, "f", "", "cities file (CSV)")
+	flag.StringVar(&dataFile, "f", "", "cities file (CSV or TSPLIB)")
 	flag.StringVar(&diagFile, "d", "./data/data.csv", "diagnostics file")
 	flag.StringVar(&routeFile, "r", "./data/route.txt", "output route file")
+	flag.StringVar(&tourFile, "tour", "", "output TSPLIB tour file (option)")
+	flag.StringVar(&optFile, "opt", "", "known optimal TSPLIB tour file (option)")
+	flag.StringVar(&metricName, "metric", "", "distance metric (default: file's, else euclid)")
 	flag.IntVar(&poly, "poly", 0, "polygon size (option)")
 	flag.IntVar(&numWalkers, "nw", 2, "nr walkers")
 	flag.IntVar(&numJobs, "nj", 10, "nr jobs per walker")
 	flag.IntVar(&period, "per", int(2e04), "period before cooling")
 	flag.IntVar(&srate, "srate", 100, "sampling rate")
-	flag.Float64Var(&temp, "temp", 1.0, "initial temperature")
+	flag.Float64Var(&temp, "temp", 0.0, "initial temperature (default: auto, from -chi0)")
 	flag.Float64Var(&cooling, "cool", 0.9, "cooling factor")
-	flag.StringVar(&moveclass, "mc", "reverse", "move class (default: 2-bond chain reversal)")
+	flag.StringVar(&schedule, "sched", "std", "cooling schedule: std, sigmage, linear, log, lundy, exp, huang, target (default: constant rate)")
+	flag.Float64Var(&chi0, "chi0", 0.8, "target initial acceptance of uphill moves, for auto temperature")
+	flag.Float64Var(&chiF, "chif", 0.01, "target final acceptance of smallest uphill moves, for auto final temperature")
+	flag.Float64Var(&tempFinal, "tf", 0.0, "final temperature (linear, exp schedules) (default: auto)")
+	flag.Float64Var(&alpha, "alpha", 0.0, "rate of exp schedule (default: reach -tf)")
+	flag.Float64Var(&beta, "beta", 0.0, "beta of lundy schedule")
+	flag.Float64Var(&lambda, "lambda", 0.7, "lambda of huang schedule")
+	flag.Float64Var(&acc0, "acc0", 0.5, "initial acceptance of target schedule")
+	flag.Float64Var(&acc1, "acc1", 0.001, "final acceptance of target schedule")
+	flag.Float64Var(&gain, "gain", 1.0, "feedback gain of target schedule")
+	flag.StringVar(&rule, "rule", "metropolis", "acceptance rule: metropolis, better (downhill only), threshold (uphill below temperature), deluge, rrt")
+	flag.Float64Var(&rain, "rain", 0.0, "fall of water level per iteration, for deluge (default: from the initial distance to a lower bound over the iterations)")
+	flag.Float64Var(&deviation, "dev", 0.01, "deviation above best distance, for rrt")
+	flag.StringVar(&moveclass, "mc", "reverse", "move class(es), comma-separated: reverse, swap, oropt, shift, 3opt, exchange, bridge (default: 2-bond chain reversal)")
+	flag.StringVar(&moveweights, "mw", "", "move class weights, comma-separated (default: equal)")
+	flag.StringVar(&adapt, "adapt", "", "adaptive move class weights by acceptance (acc) or improvement (imp) rate")
+	flag.StringVar(&ladder, "pt", "", "parallel tempering with temperature ladder geo or adapt, from -temp to -tf (default: independent walkers)")
+	flag.StringVar(&initName, "init", "random", "initial tour: random, nn, greedy, cheapest, farthest, hull, hilbert, christofides, or a tour/route file")
+	flag.StringVar(&polish, "polish", "", "locally optimise the best route found: 2opt, oropt or lk (option)")
+	flag.IntVar(&nn, "nn", 0, "propose moves towards k nearest neighbours (0: uniform)")
+	flag.BoolVar(&open, "open", false, "open path rather than closed tour")
+	flag.StringVar(&startCity, "start", "", "fixed start city (label) of an open path (implies -open)")
+	flag.StringVar(&endCity, "end", "", "fixed end city (label) of an open path (implies -open)")
+	flag.IntVar(&lbIters, "lb", 0, "subgradient iterations for the Held-Karp lower bound, reported with the gap to it (0: none)")
 	flag.BoolVar(&verbose, "v", false, "verbose")
 	flag.BoolVar(&pr, "pr", false, "print route")
 	flag.Parse()
@@ -79,34 +114,151 @@ func main() {
 	// initialise TSP problem
 	var prob tspProblem
 	if dataFile != "" {
-		prob = readCsv(dataFile)
-		npoints = len(prob.points)
+		var err error
+		prob, err = readProblem(dataFile, metricName)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		npoints = prob.dist.size()
 	} else if poly > 0 {
 		prob = makePolygon(poly)
 		npoints = poly
+		if metricName != "" {
+			if err := prob.setMetric(metricName); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
 	}
 	if npoints == 0 {
 		fmt.Println("No problem to process")
 		return
 	}
+	if open || startCity != "" || endCity != "" {
+		if err := prob.setOpen(startCity, endCity); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if lbIters > 0 {
+			fmt.Println(checkClosed(prob, "lower bound"))
+			return
+		}
+	}
+
+	// known optimum
+	opt_e := 0.0
+	if optFile != "" {
+		opt, err := readProblemTour(optFile, prob)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		opt_e = travelDist(opt, prob.dist)
+	}
+
+	// initial tour
+	init_s, err := initialTour(initName, prob)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if init_s != nil {
+		fmt.Printf("Initial tour %s: distance %v\n", initName, travelDist(init_s, prob.dist))
+	}
 
 	// initialise Metropolis parameters
 	par := annealParam{
 		period:      period,
 		srate:       srate,
 		cooling:     cooling,
-		temperature: temp}
+		schedule:    schedule,
+		temperature: temp,
+		maxIter:     numJobs * period,
+		nperiods:    numJobs,
+		tempFinal:   tempFinal,
+		alpha:       alpha,
+		beta:        beta,
+		lambda:      lambda,
+		acc0:        acc0,
+		acc1:        acc1,
+		gain:        gain,
+		acceptor:    rule,
+		rain:        rain,
+		deviation:   deviation}
+	if rule == "deluge" && rain <= 0 {
+		par.floor = nearestBound(prob.dist)
+	}
 
 	// set move class
-	var move func(int, int, []int)
-	var delta func(int, int, []int, [][]float64) float64
-	switch moveclass {
-	case "swap":
-		move = swap
-		delta = swapDelta
+	moves, err := parseMoveMix(moveclass, moveweights, adapt)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if prob.asymmetric {
+		if moves, err = asymmetricMoves(moves); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if moves, err = openMoves(moves, prob.dist); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// neighbour lists for restricted proposals
+	var neighbours [][]int
+	if nn > 0 {
+		neighbours = neighbourLists(prob, nn)
+	}
+
+	// automatic initial and final temperatures, unless given explicitly
+	probe := tspWalker{
+		problem:    prob,
+		state:      startTour(init_s, prob),
+		moves:      moves,
+		neighbours: neighbours}
+	if err := probe.autoTemperature(&par, chi0, chiF, usesTempFinal(par) || ladder != ""); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if _, err := newSchedule(par); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if _, err := newAcceptor(par, 1.0); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if polish != "" {
+		if err := checkLocalOpt(polish); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := checkSymmetric(prob, "local search"); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := checkClosed(prob, "local search"); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	switch ladder {
+	case "":
+	case "geo", "adapt":
+		if numWalkers < 2 || par.tempFinal <= 0 || par.tempFinal >= par.temperature {
+			fmt.Println("parallel tempering needs at least 2 walkers and final temperature below initial")
+			return
+		}
+		if rule != "metropolis" {
+			fmt.Println("parallel tempering needs the metropolis acceptance rule")
+			return
+		}
 	default:
-		move = reverse
-		delta = reverseDelta
+		fmt.Printf("unknown temperature ladder %q\n", ladder)
+		return
 	}
 
 	// channel for walkers to report on
@@ -123,25 +275,43 @@ func main() {
 	var best_e float64
 	best_e = float64(1 << 32)
 
+	walkers := make([]tspWalker, numWalkers)
 	for i := 0; i < numWalkers; i++ {
-
+		walkers[i] = tspWalker{
+			id:         i,
+			problem:    prob,
+			param:      par,
+			state:      startTour(init_s, prob),
+			moves:      moves,
+			neighbours: neighbours,
+			verbose:    verbose}
+	}
+	if ladder != "" {
+		// replicas exchange temperatures
+		temps := geometricLadder(par.temperature, par.tempFinal, numWalkers)
 		wg.Add(1)
-		w := tspWalker{
-			id:      i,
-			problem: prob,
-			param:   par,
-			state:   rand.Perm(npoints),
-			move:    move,
-			delta:   delta,
-			verbose: verbose}
-
 		go func() {
 			defer wg.Done()
-			w.explore(numJobs, results)
+			parallelTempering(walkers, temps, ladder == "adapt", numJobs, results)
 		}()
+	} else {
+		for _, w := range walkers {
+			wg.Add(1)
+			go func(w tspWalker) {
+				defer wg.Done()
+				w.explore(numJobs, results)
+			}(w)
+		}
 	}
 	// collect and report results
-	fmt.Fprintf(wrt, "walker,temperature,iteration,energy\n")
+	fmt.Fprintf(wrt, "walker,temperature,iteration,energy,metric")
+	for _, mc := range moves.classes {
+		fmt.Fprintf(wrt, ",acc_%s", mc.name)
+	}
+	if ladder != "" {
+		fmt.Fprintf(wrt, ",rung,exchanged")
+	}
+	fmt.Fprintf(wrt, "\n")
 	ct := 0
 	for i := 0; i < numWalkers*numJobs; i++ {
 
@@ -156,20 +326,52 @@ func main() {
 
 		// write diagnostics
 		for iter, e := range res.energy {
-			fmt.Fprintf(wrt, "%d,%v,%d,%v\n", res.id, res.temperature, iter, e)
+			fmt.Fprintf(wrt, "%d,%v,%d,%v,%s", res.id, res.temperature, iter, e, prob.metric)
+			for _, acc := range res.acceptance {
+				fmt.Fprintf(wrt, ",%v", acc)
+			}
+			if ladder != "" {
+				exchanged := 0
+				if res.exchanged {
+					exchanged = 1
+				}
+				fmt.Fprintf(wrt, ",%d,%d", res.rung, exchanged)
+			}
+			fmt.Fprintf(wrt, "\n")
 		}
 	}
 	wg.Wait()
 	wrt.Flush()
 
+	// local optimisation of the best route, reported raw and optimised
+	raw_e := best_e
+	if polish != "" {
+		polishTour(polish, best_s, prob, neighbours)
+		best_e = travelDist(best_s, prob.dist)
+		fmt.Printf("Best distance annealed: %v, locally optimised (%s): %v\n", raw_e, polish, best_e)
+	}
+
 	// write winning state
 	writePerm(best_s, routeFile)
 	if pr {
-		printRoute(best_s, prob.labels)
+		printRoute(best_s, prob.labels, isOpen(prob.dist))
 	}
 
 	// report
-	fmt.Printf("Best distance found: %v\n", best_e)
+	fmt.Printf("Best distance found: %v (metric %s)\n", best_e, prob.metric)
 	fmt.Printf("Best route written to %s\n", routeFile)
+	if tourFile != "" {
+		writeTour(best_s, tourFile)
+		fmt.Printf("Best tour written to %s\n", tourFile)
+	}
+	if opt_e > 0 {
+		if polish != "" {
+			reportGap(raw_e, "optimum", opt_e)
+		}
+		reportGap(best_e, "optimum", opt_e)
+	}
+	if lbIters > 0 {
+		reportGap(best_e, "lower bound", heldKarpBound(prob, best_e, lbIters))
+	}
 	fmt.Printf("Written %d diagnostic records to %s\n", ct, diagFile)
 }
@@ -0,0 +1,189 @@
+/*
+
+Iterated local search (see tsp/ils.go): local optimum -> double-bridge kick ->
+local search -> accept if better, or by an annealing-like acceptance rule.
+Parallel walkers report as in search.go; the wall-clock budget -time allows
+comparison with annealing at equal time.
+
+Build with make.
+
+Run with:
+
+./bin/ils -h
+
+./bin/ils -poly 1000 -niters 1000 -v
+./bin/ils -dat ./data/gb_cities.csv -pr
+
+// equal time against annealing (search -time 60s), 4 walkers
+./bin/ils -dat ./data/eire.csv -nw 4 -time 60s -niters 100000000 -cd 100000000
+
+// accept worse optima with probability exp(-delta/T), cooling every 1000 kicks
+./bin/ils -dat ./data/eire.csv -rule metropolis -temp 50 -cool 0.9 -per 1000 -time 60s
+
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+func main() {
+
+	// variables
+	var dataFile, outFile, tourFile, optFile string
+	var method, rule, schedule, metricName string
+	var temp, cooling float64
+	var poly, nwalkers, niters, countdown, period, nn int
+	var budget time.Duration
+	var npoints int = 0
+	var verbose, pr bool
+
+	// cmd line arguments
+	flag.StringVar(&dataFile, "dat", "", "cities file (CSV or TSPLIB)")
+	flag.StringVar(&outFile, "out", "route.txt", "output file")
+	flag.StringVar(&tourFile, "tour", "", "output TSPLIB tour file (option)")
+	flag.StringVar(&optFile, "opt", "", "known optimal TSPLIB tour file (option)")
+	flag.StringVar(&metricName, "metric", "", "distance metric (default: file's, else euclid)")
+	flag.IntVar(&poly, "poly", 0, "polygon size (option)")
+	flag.IntVar(&nwalkers, "nw", 1, "nr walkers")
+	flag.IntVar(&niters, "niters", int(1e04), "max nr kicks")
+	flag.IntVar(&countdown, "cd", 1000, "stop after this many kicks without improvement")
+	flag.DurationVar(&budget, "time", 0, "wall-clock budget, e.g. 30s (default: none)")
+	flag.StringVar(&method, "ls", "lk", "local search: 2opt, oropt or lk")
+	flag.StringVar(&rule, "rule", "better", "acceptance of kicked optima: better, metropolis, threshold, deluge, rrt")
+	flag.Float64Var(&temp, "temp", 1.0, "temperature (metropolis, threshold)")
+	flag.Float64Var(&cooling, "cool", 1.0, "cooling factor per period")
+	flag.StringVar(&schedule, "sched", "std", "cooling schedule (see search)")
+	flag.IntVar(&period, "per", 100, "nr kicks per period (reporting, cooling)")
+	flag.IntVar(&nn, "nn", optNeighbours, "nr nearest neighbours for local search")
+	flag.BoolVar(&verbose, "v", false, "verbose")
+	flag.BoolVar(&pr, "pr", false, "print route")
+	flag.Parse()
+
+	// initialise TSP problem
+	var prob tspProblem
+	if dataFile != "" {
+		var err error
+		prob, err = readProblem(dataFile, metricName)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		npoints = prob.dist.size()
+	} else if poly > 0 {
+		prob = makePolygon(poly)
+		npoints = poly
+		if metricName != "" {
+			if err := prob.setMetric(metricName); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+	}
+	if npoints == 0 {
+		fmt.Println("No problem to process")
+		return
+	}
+
+	// known optimum
+	opt_e := 0.0
+	if optFile != "" {
+		opt, err := readProblemTour(optFile, prob)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		opt_e = travelDist(opt, prob.dist)
+	}
+
+	// initialise parameters
+	par := annealParam{
+		temperature: temp,
+		cooling:     cooling,
+		schedule:    schedule,
+		period:      period,
+		maxIter:     niters,
+		nperiods:    niters / period,
+		countdown:   countdown,
+		budget:      budget,
+		acceptor:    rule,
+		deviation:   0.01,
+		localSearch: method}
+	if rule == "deluge" {
+		par.floor = nearestBound(prob.dist)
+	}
+	if err := checkLocalOpt(method); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := checkSymmetric(prob, "local search"); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if _, err := newSchedule(par); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if _, err := newAcceptor(par, 1.0); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// neighbour lists for local search, shared by the walkers
+	neighbours := neighbourLists(prob, nn)
+
+	// channel for walkers to report on
+	results := make(chan packet, nwalkers)
+
+	// run walkers
+	var wg sync.WaitGroup
+	for i := 0; i < nwalkers; i++ {
+
+		wg.Add(1)
+		w := tspWalker{
+			id:         i,
+			problem:    prob,
+			param:      par,
+			state:      rand.Perm(npoints),
+			neighbours: neighbours,
+			verbose:    verbose}
+
+		go func() {
+			defer wg.Done()
+			w.iteratedLocalSearch(results)
+		}()
+	}
+
+	// collect results
+	best_s := make([]int, npoints)
+	best_e := float64(1 << 32)
+
+	for i := 0; i < nwalkers; i++ {
+		res := <-results
+		if res.best_e < best_e {
+			best_e = res.best_e
+			copy(best_s, res.best_s)
+		}
+	}
+	wg.Wait()
+
+	// report results
+	if pr {
+		printRoute(best_s, prob.labels, isOpen(prob.dist))
+	}
+	writePerm(best_s, "./data/"+outFile)
+	fmt.Printf("Best distance found: %v (metric %s)\n", best_e, prob.metric)
+	fmt.Printf("Best route written to %s\n", "./data/"+outFile)
+	if tourFile != "" {
+		writeTour(best_s, tourFile)
+		fmt.Printf("Best tour written to %s\n", tourFile)
+	}
+	if opt_e > 0 {
+		reportGap(best_e, "optimum", opt_e)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+
+Deterministic local search (see tsp/localopt.go): 2-opt, Or-opt, or Lin-Kernighan
+style variable-depth moves, with neighbour lists and don't-look bits.
+
+Starts from a random route, or from a given tour: a TSPLIB tour or a route
+file written by search/explore, e.g. to polish an annealing result.
+
+Build with make.
+
+Run with:
+
+./bin/localopt -h
+
+./bin/localopt -poly 1000 -ls 2opt
+./bin/localopt -dat ./data/gb_cities.csv -pr
+
+// polish the best route of an annealing run
+./bin/search -dat ./data/eire.csv -niters 100000000 -per 100000
+./bin/localopt -dat ./data/eire.csv -init ./data/route.txt -ls lk
+
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+func main() {
+
+	// variables
+	var dataFile, initFile, outFile, tourFile, optFile string
+	var method, metricName string
+	var poly, nn int
+	var npoints int = 0
+	var pr bool
+
+	// cmd line arguments
+	flag.StringVar(&dataFile, "dat", "", "cities file (CSV or TSPLIB)")
+	flag.StringVar(&initFile, "init", "", "initial TSPLIB tour or route file (default: random)")
+	flag.StringVar(&outFile, "out", "route.txt", "output file")
+	flag.StringVar(&tourFile, "tour", "", "output TSPLIB tour file (option)")
+	flag.StringVar(&optFile, "opt", "", "known optimal TSPLIB tour file (option)")
+	flag.StringVar(&metricName, "metric", "", "distance metric (default: file's, else euclid)")
+	flag.IntVar(&poly, "poly", 0, "polygon size (option)")
+	flag.StringVar(&method, "ls", "lk", "local search: 2opt, oropt (2-opt and Or-opt) or lk (Or-opt and LK-style moves)")
+	flag.IntVar(&nn, "nn", 10, "nr nearest neighbours to search")
+	flag.BoolVar(&pr, "pr", false, "print route")
+	flag.Parse()
+
+	// initialise TSP problem
+	var prob tspProblem
+	if dataFile != "" {
+		var err error
+		prob, err = readProblem(dataFile, metricName)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		npoints = prob.dist.size()
+	} else if poly > 0 {
+		prob = makePolygon(poly)
+		npoints = poly
+		if metricName != "" {
+			if err := prob.setMetric(metricName); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+	}
+	if npoints == 0 {
+		fmt.Println("No problem to process")
+		return
+	}
+
+	// known optimum
+	opt_e := 0.0
+	if optFile != "" {
+		opt, err := readProblemTour(optFile, prob)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		opt_e = travelDist(opt, prob.dist)
+	}
+
+	// initial route
+	route := rand.Perm(npoints)
+	if initFile != "" {
+		var err error
+		route, err = readProblemTour(initFile, prob)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	init_e := travelDist(route, prob.dist)
+
+	// optimise
+	if err := checkSymmetric(prob, "local search"); err != nil {
+		fmt.Println(err)
+		return
+	}
+	start := time.Now()
+	lo, err := newLocalOpt(method, route, prob.dist, neighbourLists(prob, nn))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	lo.run(nil)
+	runtime := time.Since(start)
+	best_e := travelDist(route, prob.dist)
+
+	// report results
+	if pr {
+		printRoute(route, prob.labels, isOpen(prob.dist))
+	}
+	writePerm(route, "./data/"+outFile)
+	fmt.Printf("Initial distance %v, locally optimised (%s) %v in time %v (metric %s)\n",
+		init_e, method, best_e, runtime, prob.metric)
+	fmt.Printf("Best route written to %s\n", "./data/"+outFile)
+	if tourFile != "" {
+		writeTour(route, tourFile)
+		fmt.Printf("Best tour written to %s\n", tourFile)
+	}
+	if opt_e > 0 {
+		reportGap(best_e, "optimum", opt_e)
+	}
+}
@@ -7,6 +7,10 @@ make makepolydata
 ./bin/makepolydata -nrun 990 -o data/polydata_sigmage.csv -sched sigmage -maxiter 1000000000
 ./bin/makepolydata -nrun 1000 -o data/polydata_std.csv -sched std -maxiter 1000000000
 
+Other schedules (see tsp/schedule.go) take their parameters from flags, e.g.
+./bin/makepolydata -nrun 1000 -o data/polydata_lundy.csv -sched lundy -beta 0.05 -maxiter 1000000000
+./bin/makepolydata -nrun 1000 -o data/polydata_exp.csv -sched exp -tf 0.001 -maxiter 1000000000
+
 
 */
 
@@ -25,8 +29,9 @@ func main() {
 
 	// variables
 	var outFile string
-	var moveclass, schedule string
+	var moveclass, moveweights, adapt, schedule string
 	var nruns, niters, minn, maxn int
+	var tempFinal, alpha, beta, lambda float64
 
 	// cmd line arguments
 	flag.StringVar(&outFile, "o", "data/polydata.csv", "output file")
@@ -34,20 +39,34 @@ func main() {
 	flag.IntVar(&maxn, "max", int(5000), "max polygon size")
 	flag.IntVar(&nruns, "nrun", int(100), "nr experiments")
 	flag.IntVar(&niters, "maxiter", int(1e08), "max iters per experiment")
-	flag.StringVar(&moveclass, "mc", "reverse", "move class (default: 2-bond chain reversal)")
-	flag.StringVar(&schedule, "sched", "std", "cooling schedule (default: constant rate)")
+	flag.StringVar(&moveclass, "mc", "reverse", "move class(es), comma-separated: reverse, swap, oropt, shift, 3opt, exchange, bridge (default: 2-bond chain reversal)")
+	flag.StringVar(&moveweights, "mw", "", "move class weights, comma-separated (default: equal)")
+	flag.StringVar(&adapt, "adapt", "", "adaptive move class weights by acceptance (acc) or improvement (imp) rate")
+	flag.StringVar(&schedule, "sched", "std", "cooling schedule: std, sigmage, linear, log, lundy, exp, huang (default: constant rate)")
+	flag.Float64Var(&tempFinal, "tf", 0.0, "final temperature (linear, exp schedules)")
+	flag.Float64Var(&alpha, "alpha", 0.0, "rate of exp schedule (default: reach -tf)")
+	flag.Float64Var(&beta, "beta", 0.0, "beta of lundy schedule")
+	flag.Float64Var(&lambda, "lambda", 0.7, "lambda of huang schedule")
 	flag.Parse()
 
+	// schedule parameters, fixed across experiments
+	base := annealParam{
+		schedule:  schedule,
+		maxIter:   niters,
+		tempFinal: tempFinal,
+		alpha:     alpha,
+		beta:      beta,
+		lambda:    lambda}
+	if _, err := newSchedule(makeParam(base)); err != nil {
+		fmt.Println(err)
+		return
+	}
+
 	// set move class
-	var move func(int, int, []int)
-	var delta func(int, int, []int, [][]float64) float64
-	switch moveclass {
-	case "swap":
-		move = swap
-		delta = swapDelta
-	default:
-		move = reverse
-		delta = reverseDelta
+	moves, err := parseMoveMix(moveclass, moveweights, adapt)
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
 
 	// open output file
@@ -64,16 +83,21 @@ func main() {
 		prob := makePolygon(npoints)
 
 		// set randomised walker
-		par := makeParam(niters, schedule)
+		par := makeParam(base)
+		if _, err := newSchedule(par); err != nil {
+			fmt.Printf("run %d skipped: %v\n", i, err)
+			continue
+		}
 		wkr := tspWalker{
 			problem: prob,
 			param:   par,
 			state:   rand.Perm(npoints),
-			move:    move,
-			delta:   delta}
+			moves:   moves}
 
+		results := make(chan packet, 1)
 		start := time.Now()
-		E, _ := wkr.search() // <---- CORRECTION NEEDED: EDIT FOR USE AS GO ROUTINE
+		wkr.search(results)
+		E := (<-results).best_e
 		t := time.Since(start).Seconds()
 
 		// report
@@ -89,19 +113,19 @@ func main() {
 	}
 }
 
-func makeParam(niters int, schedule string) annealParam {
+func makeParam(base annealParam) annealParam {
 
-	temp := 1.0 + 3.0*rand.Float64()
-	cooling := 0.8 + 0.2*rand.Float64()
-	period := 20 * (50 + rand.Intn(949))
-
-	par := annealParam{
-		schedule:    schedule,
-		maxIter:     niters,
-		temperature: temp,
-		cooling:     cooling,
-		period:      period,
-		countdown:   40}
+	par := base
+	// initial temperature in (1, 4), above the final temperature of the schedule
+	lo := 1.0
+	if usesTempFinal(base) && base.tempFinal > lo {
+		lo = base.tempFinal
+	}
+	par.temperature = lo + (4.0-lo)*rand.Float64()
+	par.cooling = 0.8 + 0.2*rand.Float64()
+	par.period = 20 * (50 + rand.Intn(949))
+	par.countdown = 40
+	par.nperiods = par.maxIter / par.period
 
 	return par
 }
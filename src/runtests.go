@@ -1,12 +1,19 @@
 /*
 
-Code to run standard test on two move classes, using variable-sized polygon problems
+Code to run standard test on the move classes, using variable-sized polygon problems
 
 Build with make, run with
 
 ./bin/runtests -h
 ./bin/runtests -n 100
 
+// check that annealing reaches the exact optimum (tsp/exact.go) on the
+// polygon and on random cities
+./bin/runtests -n 15 -exact
+
+// deltas of the move classes on 4 salesmen (mTSP), both objectives
+./bin/runtests -n 100 -m 4
+
 etc
 
 */
@@ -21,35 +28,91 @@ import (
 
 func main() {
 
-	var n int
+	var n, nn, m int
+	var exact bool
 	flag.IntVar(&n, "n", 100, "nr points to test on")
+	flag.IntVar(&nn, "nn", 0, "test neighbour-list proposals with k nearest neighbours")
+	flag.IntVar(&m, "m", 1, "also test deltas with m salesmen (mTSP), total and minmax objectives")
+	flag.BoolVar(&exact, "exact", false, "check that annealing reaches the exact optimum")
 	flag.Parse()
 
 	prob := makePolygon(n)
 	par := annealParam{maxIter: 1e06}
-
-	w_swap := tspWalker{
-		problem: prob,
-		param:   par,
-		state:   rand.Perm(n),
-		move:    swap,
-		delta:   swapDelta}
-	w_rev := tspWalker{
-		problem: prob,
-		param:   par,
-		state:   rand.Perm(n),
-		move:    reverse,
-		delta:   reverseDelta}
+	var neighbours [][]int
+	if nn > 0 {
+		neighbours = neighbourLists(prob, nn)
+	}
 
 	fmt.Printf("Testing for problem on %d points\n", n)
-	fmt.Println("Swapping moves:")
-	w_swap.testDelta(1e-10)
-	w_swap.timeMove()
-	w_swap.timeDelta()
-	w_swap.timeEnergy()
-	fmt.Println("Reversing moves:")
-	w_rev.testDelta(1e-10)
-	w_rev.timeMove()
-	w_rev.timeDelta()
-	w_rev.timeEnergy()
+	for _, name := range []string{"swap", "reverse", "oropt", "shift", "3opt", "exchange", "bridge"} {
+
+		mc, _ := getMoveClass(name)
+		w := tspWalker{
+			problem:    prob,
+			param:      par,
+			state:      rand.Perm(n),
+			moves:      singleMove(mc),
+			neighbours: neighbours}
+
+		fmt.Printf("Move class %s:\n", name)
+		w.testDelta(1e-10)
+		w.timeMove()
+		w.timeDelta()
+		w.timeEnergy()
+	}
+
+	// edges of reverse and swap moves, for the tabu list
+	fmt.Printf("Tabu move edges:\n")
+	testMoveEdges(n)
+
+	// mTSP deltas
+	for _, obj := range []string{"total", "minmax"} {
+
+		if m < 2 {
+			break
+		}
+		p := makePolygon(n)
+		if err := p.setSalesmen(m, "", obj); err != nil {
+			fmt.Println(err)
+			return
+		}
+		for _, name := range []string{"swap", "reverse", "oropt", "shift", "3opt", "exchange", "bridge"} {
+
+			mc, _ := getMoveClass(name)
+			w := tspWalker{
+				problem: p,
+				param:   annealParam{maxIter: 1e05},
+				state:   startTour(nil, p),
+				moves:   mtspMoves(singleMove(mc), p.dist)}
+
+			fmt.Printf("Move class %s, %d salesmen (%s):\n", name, m, obj)
+			w.testDelta(1e-10)
+		}
+	}
+
+	if !exact {
+		return
+	}
+
+	// annealing against the exact optimum
+	for _, p := range []tspProblem{prob, makeRandom(n)} {
+
+		opt, err := exactTour("auto", p)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		mc, _ := getMoveClass("reverse")
+		w := tspWalker{
+			problem:    p,
+			param:      annealParam{cooling: 0.9, period: 1e04, maxIter: 1e08, countdown: 400},
+			state:      rand.Perm(n),
+			moves:      singleMove(mc),
+			neighbours: neighbours}
+		if err := w.autoTemperature(&w.param, 0.8, 0.01, false); err != nil {
+			fmt.Println(err)
+			return
+		}
+		w.testOptimum(travelDist(opt, p.dist), 1e-9)
+	}
 }
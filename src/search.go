@@ -14,6 +14,7 @@ Run with:
 // ~1.4s
 
 // 10,000-gon
+// (start from a constructed tour, e.g. -init greedy, to skip the high-temperature phase)
 
 // Best regime found:
 ./bin/search -poly 10000 -temp 1.0 -niters 1000000000 -v -sched sigmage
@@ -22,16 +23,27 @@ Run with:
 // I haven't been able to improve on this (i.e. cooling based on sigmage over bins)
 // with standard schedule.
 
+// Neighbour-list proposals (10 nearest) reach the optimum in a fraction of the time:
+./bin/search -poly 10000 -temp 0.1 -niters 20000000 -per 100000 -nn 10
+// Found distance 6.2831852119416 in time 47.746956859s
+
 // GB 79 cities
 ./bin/search -dat ./data/gb_cities.csv -pr
+// (lat/long file: -metric haversine optimises great-circle km)
 Rscript ./R/drawRoute.R ./data/gb_cities.csv ./data/route.txt ./img/map.pdf
 
 // Eire
 // the Eire data set is much more challenging -  claimed optimal value = 206,171:
 // https://www.math.uwaterloo.ca/tsp/world/eilog.html
+// given the published optimal tour, the gap is reported with e.g.
+// ./bin/search -dat ./data/eire.csv -opt ./data/ei8246.opt.tour ...
+// and without it, against the Held-Karp lower bound (100 subgradient steps,
+// each a spanning tree on all cities):
+// ./bin/search -dat ./data/eire.csv -lb 100 ...
 
 ./bin/search -dat ./data/eire.csv -v -niters 1000000000 -temp 10.0 -cool 0.9999 -per 100000
 // Found distance 219027.2245719097 in time 5m7.335534685s
+// (add -polish lk to report the best route both raw and locally optimised)
 
 // with sigmage schedule
 
@@ -40,6 +52,39 @@ Rscript ./R/drawRoute.R ./data/gb_cities.csv ./data/route.txt ./img/map.pdf
 
 // Initial temp 1000.0 suggested by landscape portrait, but this performs less well.
 
+// reheating from the best state when the best is unchanged for 50 periods,
+// so long runs don't spend their second half frozen:
+./bin/search -dat ./data/eire.csv -v -niters 1000000000 -cool 0.9999 -per 100000 -reheat best -stag 50 -maxreheat 5
+
+// population annealing: 50 replicas cooled together, resampled by Boltzmann weights
+// at each temperature (-v reports free energy and population diversity per step)
+./bin/search -dat ./data/gb_cities.csv -pa -nw 50 -per 2000 -cool 0.95 -v
+
+// deterministic acceptance rules on the same moves and countdown, e.g.
+./bin/search -dat ./data/gb_cities.csv -rule threshold -temp 50 -cool 0.95
+./bin/search -dat ./data/gb_cities.csv -rule deluge
+./bin/search -dat ./data/gb_cities.csv -rule rrt -dev 0.02
+
+// equal-time comparison with iterated local search (ils.go)
+./bin/search -dat ./data/eire.csv -niters 1000000000 -per 100000 -time 60s
+./bin/ils -dat ./data/eire.csv -time 60s
+
+// TSPLIB instances (.tsp) are read through the same flag, e.g.
+./bin/search -dat ./data/eil51.tsp -temp 10.0 -per 10000 -pr
+
+// open paths (no edge back to the start), e.g. from a depot to a given city;
+// drawn with Rscript ./R/drawRoute.R ... open
+./bin/search -dat ./data/gb_cities.csv -start London -end Inverness -pr
+
+// multiple salesmen (mTSP): 4 tours from London, minimising the longest
+// (-obj minmax) or the total length; -pr lists each salesman's tour
+./bin/search -dat ./data/gb_cities.csv -m 4 -depot London -obj minmax -nw 4 -pr
+
+// asymmetric instances: TSPLIB ATSP (.atsp) or a CSV of distances with header
+// from,to,distance - with direction-preserving moves, or reverse (with a delta
+// over the reversed chain); oropt and 3opt, and local search, are rejected
+./bin/search -dat ./data/ftv33.atsp -mc reverse,shift,exchange
+
 (NOTE that the move class _swap_ is dramatically worse then _reverse_ on all problems.)
 
 */
@@ -49,33 +94,75 @@ package main
 import (
 	"flag"
 	"fmt"
-	"math/rand"
 	"sync"
+	"time"
 )
 
 func main() {
 
 	// variables
-	var dataFile, outFile string
-	var moveclass, schedule string
-	var temp, cooling float64
-	var period, countdown int
-	var poly, nwalkers, niters int
+	var dataFile, outFile, tourFile, optFile string
+	var moveclass, moveweights, adapt, schedule, metricName string
+	var temp, cooling, tempFinal, alpha, beta, lambda float64
+	var chi0, chiF, acc0, acc1, gain float64
+	var rule, polish, initName string
+	var rain, deviation float64
+	var period, countdown, stagnation, maxReheats int
+	var reheat string
+	var reheatFrac float64
+	var budget time.Duration
+	var poly, nwalkers, niters, nn, lbIters int
 	var npoints int = 0
-	var verbose, pr bool
+	var verbose, pr, popAnneal, open bool
+	var startCity, endCity string
+	var salesmen int
+	var depot, objective string
 
 	// cmd line arguments
-	flag.StringVar(&dataFile, "dat", "", "cities file (CSV)")
+	flag.StringVar(&dataFile, "dat", "", "cities file (CSV or TSPLIB)")
 	flag.StringVar(&outFile, "out", "route.txt", "output file")
+	flag.StringVar(&tourFile, "tour", "", "output TSPLIB tour file, one tour per salesman (option)")
+	flag.StringVar(&optFile, "opt", "", "known optimal TSPLIB tour file (option)")
+	flag.StringVar(&metricName, "metric", "", "distance metric (default: file's, else euclid)")
 	flag.IntVar(&poly, "poly", 0, "polygon size (option)")
 	flag.IntVar(&nwalkers, "nw", 1, "nr walkers")
 	flag.IntVar(&period, "per", int(1e04), "period at each temparature")
 	flag.IntVar(&countdown, "cd", 400, "countdown for acceptance condition")
+	flag.StringVar(&reheat, "reheat", "", "reheat on stagnation: best, current (to -rfrac of initial temperature) or restart (best state, initial temperature)")
+	flag.Float64Var(&reheatFrac, "rfrac", 0.5, "reheat to this fraction of initial temperature")
+	flag.IntVar(&maxReheats, "maxreheat", 3, "max nr reheats")
+	flag.IntVar(&stagnation, "stag", 0, "periods without improvement before reheating (default: -cd)")
 	flag.IntVar(&niters, "niters", int(1e06), "max iterations for search")
-	flag.Float64Var(&temp, "temp", 4.0, "initial temperature")
+	flag.DurationVar(&budget, "time", 0, "wall-clock budget, e.g. 30s (default: none)")
+	flag.Float64Var(&temp, "temp", 0.0, "initial temperature (default: auto, from -chi0)")
 	flag.Float64Var(&cooling, "cool", 0.9, "cooling factor")
-	flag.StringVar(&moveclass, "mc", "reverse", "move class (default: 2-bond chain reversal)")
-	flag.StringVar(&schedule, "sched", "std", "cooling schedule (default: constant rate)")
+	flag.StringVar(&moveclass, "mc", "reverse", "move class(es), comma-separated: reverse, swap, oropt, shift, 3opt, exchange, bridge (default: 2-bond chain reversal)")
+	flag.StringVar(&moveweights, "mw", "", "move class weights, comma-separated (default: equal)")
+	flag.StringVar(&adapt, "adapt", "", "adaptive move class weights by acceptance (acc) or improvement (imp) rate")
+	flag.StringVar(&schedule, "sched", "std", "cooling schedule: std, sigmage, linear, log, lundy, exp, huang, target (default: constant rate)")
+	flag.Float64Var(&chi0, "chi0", 0.8, "target initial acceptance of uphill moves, for auto temperature")
+	flag.Float64Var(&chiF, "chif", 0.01, "target final acceptance of smallest uphill moves, for auto final temperature")
+	flag.Float64Var(&tempFinal, "tf", 0.0, "final temperature (linear, exp schedules) (default: auto)")
+	flag.Float64Var(&alpha, "alpha", 0.0, "rate of exp schedule (default: reach -tf)")
+	flag.Float64Var(&beta, "beta", 0.0, "beta of lundy schedule")
+	flag.Float64Var(&lambda, "lambda", 0.7, "lambda of huang schedule")
+	flag.Float64Var(&acc0, "acc0", 0.5, "initial acceptance of target schedule")
+	flag.Float64Var(&acc1, "acc1", 0.001, "final acceptance of target schedule")
+	flag.Float64Var(&gain, "gain", 1.0, "feedback gain of target schedule")
+	flag.StringVar(&rule, "rule", "metropolis", "acceptance rule: metropolis, better (downhill only), threshold (uphill below temperature), deluge, rrt")
+	flag.Float64Var(&rain, "rain", 0.0, "fall of water level per iteration, for deluge (default: from the initial distance to a lower bound over the iterations)")
+	flag.Float64Var(&deviation, "dev", 0.01, "deviation above best distance, for rrt")
+	flag.BoolVar(&popAnneal, "pa", false, "population annealing, with -nw replicas cooled in lockstep")
+	flag.StringVar(&initName, "init", "random", "initial tour: random, nn, greedy, cheapest, farthest, hull, hilbert, christofides, or a tour/route file")
+	flag.StringVar(&polish, "polish", "", "locally optimise the best route found: 2opt, oropt or lk (option)")
+	flag.IntVar(&nn, "nn", 0, "propose moves towards k nearest neighbours (0: uniform)")
+	flag.BoolVar(&open, "open", false, "open path rather than closed tour")
+	flag.StringVar(&startCity, "start", "", "fixed start city (label) of an open path (implies -open)")
+	flag.StringVar(&endCity, "end", "", "fixed end city (label) of an open path (implies -open)")
+	flag.IntVar(&salesmen, "m", 1, "nr salesmen, with tours from a shared depot (mTSP)")
+	flag.StringVar(&depot, "depot", "", "depot city (label) of the salesmen (default: the first city)")
+	flag.StringVar(&objective, "obj", "total", "mTSP objective: total (sum of tour lengths) or minmax (longest tour)")
+	flag.IntVar(&lbIters, "lb", 0, "subgradient iterations for the Held-Karp lower bound, reported with the gap to it (0: none)")
 	flag.BoolVar(&verbose, "v", false, "verbose")
 	flag.BoolVar(&pr, "pr", false, "print route")
 	flag.Parse()
@@ -83,16 +170,75 @@ func main() {
 	// initialise TSP problem
 	var prob tspProblem
 	if dataFile != "" {
-		prob = readCsv(dataFile)
-		npoints = len(prob.points)
+		var err error
+		prob, err = readProblem(dataFile, metricName)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		npoints = prob.dist.size()
 	} else if poly > 0 {
 		prob = makePolygon(poly)
 		npoints = poly
+		if metricName != "" {
+			if err := prob.setMetric(metricName); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
 	}
 	if npoints == 0 {
 		fmt.Println("No problem to process")
 		return
 	}
+	if open || startCity != "" || endCity != "" {
+		if err := prob.setOpen(startCity, endCity); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if lbIters > 0 {
+			fmt.Println(checkClosed(prob, "lower bound"))
+			return
+		}
+	}
+	if err := prob.setSalesmen(salesmen, depot, objective); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if salesmen > 1 {
+		npoints = prob.dist.size()
+		if optFile != "" {
+			fmt.Println("known optimum tour file needs a single salesman")
+			return
+		}
+		if lbIters > 0 {
+			if err := checkTotal(prob, "lower bound"); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+	}
+
+	// known optimum
+	opt_e := 0.0
+	if optFile != "" {
+		opt, err := readProblemTour(optFile, prob)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		opt_e = travelDist(opt, prob.dist)
+	}
+
+	// initial tour
+	init_s, err := initialTour(initName, prob)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if init_s != nil {
+		fmt.Printf("Initial tour %s: distance %v\n", initName, travelDist(init_s, prob.dist))
+	}
 
 	// initialise Metropolis parameters
 	par := annealParam{
@@ -101,18 +247,109 @@ func main() {
 		period:      period,
 		maxIter:     niters,
 		countdown:   countdown,
-		schedule:    schedule}
+		budget:      budget,
+		reheat:      reheat,
+		reheatFrac:  reheatFrac,
+		maxReheats:  maxReheats,
+		stagnation:  stagnation,
+		schedule:    schedule,
+		nperiods:    niters / period,
+		tempFinal:   tempFinal,
+		alpha:       alpha,
+		beta:        beta,
+		lambda:      lambda,
+		acc0:        acc0,
+		acc1:        acc1,
+		gain:        gain,
+		acceptor:    rule,
+		rain:        rain,
+		deviation:   deviation}
+	if rule == "deluge" && rain <= 0 {
+		par.floor = nearestBound(prob.dist)
+	}
 
 	// set move class
-	var move func(int, int, []int)
-	var delta func(int, int, []int, [][]float64) float64
-	switch moveclass {
-	case "swap":
-		move = swap
-		delta = swapDelta
+	moves, err := parseMoveMix(moveclass, moveweights, adapt)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if prob.asymmetric {
+		if moves, err = asymmetricMoves(moves); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if moves, err = openMoves(moves, prob.dist); err != nil {
+		fmt.Println(err)
+		return
+	}
+	moves = mtspMoves(moves, prob.dist)
+
+	// neighbour lists for restricted proposals
+	var neighbours [][]int
+	if nn > 0 {
+		neighbours = neighbourLists(prob, nn)
+	}
+
+	switch reheat {
+	case "", "best", "current", "restart":
 	default:
-		move = reverse
-		delta = reverseDelta
+		fmt.Printf("unknown reheat mode %q\n", reheat)
+		return
+	}
+	if par.stagnation <= 0 {
+		par.stagnation = countdown
+	}
+
+	// automatic initial and final temperatures, unless given explicitly
+	probe := tspWalker{
+		problem:    prob,
+		state:      startTour(init_s, prob),
+		moves:      moves,
+		neighbours: neighbours}
+	if err := probe.autoTemperature(&par, chi0, chiF, usesTempFinal(par)); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if _, err := newSchedule(par); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if (reheat == "best" || reheat == "current") && usesTempFinal(par) && reheatFrac*par.temperature <= par.tempFinal {
+		fmt.Printf("reheat temperature %v (-rfrac of initial) must be above the final temperature %v\n", reheatFrac*par.temperature, par.tempFinal)
+		return
+	}
+	if _, err := newAcceptor(par, 1.0); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if polish != "" {
+		if err := checkLocalOpt(polish); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := checkSymmetric(prob, "local search"); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := checkClosed(prob, "local search"); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := checkTotal(prob, "local search"); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if popAnneal && (rule != "metropolis" || init_s != nil) {
+		fmt.Println("population annealing needs the metropolis acceptance rule and random initial tours")
+		return
+	}
+	if popAnneal && salesmen > 1 {
+		// its free energy counts tours, not giant tours with depot copies
+		fmt.Println("population annealing needs a single salesman")
+		return
 	}
 
 	// channel for walkers to report on
@@ -120,21 +357,32 @@ func main() {
 
 	// run walkers
 	var wg sync.WaitGroup
+	walkers := make([]tspWalker, nwalkers)
 	for i := 0; i < nwalkers; i++ {
-
+		walkers[i] = tspWalker{
+			id:         i,
+			problem:    prob,
+			param:      par,
+			state:      startTour(init_s, prob),
+			moves:      moves,
+			neighbours: neighbours,
+			verbose:    verbose}
+	}
+	if popAnneal {
+		// replicas cooled together, resampled at each temperature
 		wg.Add(1)
-		w := tspWalker{
-			problem: prob,
-			param:   par,
-			state:   rand.Perm(npoints),
-			move:    move,
-			delta:   delta,
-			verbose: verbose}
-
 		go func() {
 			defer wg.Done()
-			w.search(results)
+			populationAnnealing(walkers, results)
 		}()
+	} else {
+		for _, w := range walkers {
+			wg.Add(1)
+			go func(w tspWalker) {
+				defer wg.Done()
+				w.search(results)
+			}(w)
+		}
 	}
 
 	// collect results
@@ -150,11 +398,32 @@ func main() {
 	}
 	wg.Wait()
 
+	// local optimisation of the best route, reported raw and optimised
+	raw_e := best_e
+	if polish != "" {
+		polishTour(polish, best_s, prob, neighbours)
+		best_e = travelDist(best_s, prob.dist)
+		fmt.Printf("Best distance annealed: %v, locally optimised (%s): %v\n", raw_e, polish, best_e)
+	}
+
 	// report results
 	if pr {
-		printRoute(best_s, prob.labels)
+		printTours(best_s, prob)
 	}
-	writePerm(best_s, "./data/"+outFile)
-	fmt.Printf("Best distance found: %v\n", best_e)
+	writePerm(cityRoute(best_s, prob.dist), "./data/"+outFile)
+	fmt.Printf("Best distance found: %v (metric %s)\n", best_e, prob.metric)
 	fmt.Printf("Best route written to %s\n", "./data/"+outFile)
+	if tourFile != "" {
+		writeSalesmenTours(best_s, prob.dist, tourFile)
+		fmt.Printf("Best tour written to %s\n", tourFile)
+	}
+	if opt_e > 0 {
+		if polish != "" {
+			reportGap(raw_e, "optimum", opt_e)
+		}
+		reportGap(best_e, "optimum", opt_e)
+	}
+	if lbIters > 0 {
+		reportGap(best_e, "lower bound", heldKarpBound(prob, best_e, lbIters))
+	}
 }
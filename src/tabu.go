@@ -0,0 +1,182 @@
+/*
+
+Tabu search on the reverse and swap move classes: a deterministic baseline for
+the annealing walkers of search.go, with the same route output.
+
+Build with make.
+
+Run with:
+
+./bin/tabu -h
+
+./bin/tabu -poly 100 -pr
+./bin/tabu -dat ./data/gb_cities.csv -tenure 10 -v
+
+// large problems: sample 1000 candidate moves per iteration (towards 10 nearest
+// neighbours) instead of scanning the full neighbourhood
+./bin/tabu -dat ./data/eire.csv -cand 1000 -nn 10 -niters 1000000 -cd 50000 -per 10000 -v
+
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+func main() {
+
+	// variables
+	var dataFile, outFile, tourFile, optFile string
+	var moveclass, metricName string
+	var poly, nwalkers, niters, countdown, period, tenure, ncand, nn int
+	var npoints int = 0
+	var verbose, pr bool
+
+	// cmd line arguments
+	flag.StringVar(&dataFile, "dat", "", "cities file (CSV or TSPLIB)")
+	flag.StringVar(&outFile, "out", "route.txt", "output file")
+	flag.StringVar(&tourFile, "tour", "", "output TSPLIB tour file (option)")
+	flag.StringVar(&optFile, "opt", "", "known optimal TSPLIB tour file (option)")
+	flag.StringVar(&metricName, "metric", "", "distance metric (default: file's, else euclid)")
+	flag.IntVar(&poly, "poly", 0, "polygon size (option)")
+	flag.IntVar(&nwalkers, "nw", 1, "nr walkers")
+	flag.IntVar(&niters, "niters", int(1e04), "max iterations")
+	flag.IntVar(&countdown, "cd", 1000, "stop after this many iterations without improvement")
+	flag.IntVar(&period, "per", 100, "reporting period")
+	flag.StringVar(&moveclass, "mc", "reverse", "move class(es), comma-separated: reverse, swap")
+	flag.IntVar(&tenure, "tenure", 0, "iterations a removed edge stays tabu (default: nr points / 10, at least 5)")
+	flag.IntVar(&ncand, "cand", 0, "sample this many candidate moves per iteration (0: full neighbourhood)")
+	flag.IntVar(&nn, "nn", 0, "sample candidates towards k nearest neighbours (0: uniform)")
+	flag.BoolVar(&verbose, "v", false, "verbose")
+	flag.BoolVar(&pr, "pr", false, "print route")
+	flag.Parse()
+
+	// initialise TSP problem
+	var prob tspProblem
+	if dataFile != "" {
+		var err error
+		prob, err = readProblem(dataFile, metricName)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		npoints = prob.dist.size()
+	} else if poly > 0 {
+		prob = makePolygon(poly)
+		npoints = poly
+		if metricName != "" {
+			if err := prob.setMetric(metricName); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+	}
+	if npoints == 0 {
+		fmt.Println("No problem to process")
+		return
+	}
+
+	// known optimum
+	opt_e := 0.0
+	if optFile != "" {
+		opt, err := readProblemTour(optFile, prob)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		opt_e = travelDist(opt, prob.dist)
+	}
+
+	// set move classes
+	moves, err := parseMoveMix(moveclass, "", "")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if prob.asymmetric {
+		if moves, err = asymmetricMoves(moves); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	for _, mc := range moves.classes {
+		if mc.name != "reverse" && mc.name != "swap" {
+			fmt.Printf("tabu search takes move classes reverse and swap, not %s\n", mc.name)
+			return
+		}
+	}
+
+	// neighbour lists for candidate sampling
+	var neighbours [][]int
+	if nn > 0 {
+		neighbours = neighbourLists(prob, nn)
+	}
+
+	if tenure <= 0 {
+		tenure = npoints / 10
+		if tenure < 5 {
+			tenure = 5
+		}
+	}
+	par := annealParam{
+		maxIter:    niters,
+		countdown:  countdown,
+		period:     period,
+		tenure:     tenure,
+		candidates: ncand}
+
+	// channel for walkers to report on
+	results := make(chan packet, nwalkers)
+
+	// run walkers
+	var wg sync.WaitGroup
+	for i := 0; i < nwalkers; i++ {
+
+		wg.Add(1)
+		w := tspWalker{
+			id:         i,
+			problem:    prob,
+			param:      par,
+			state:      rand.Perm(npoints),
+			moves:      moves,
+			neighbours: neighbours,
+			verbose:    verbose}
+
+		go func() {
+			defer wg.Done()
+			w.tabuSearch(results)
+		}()
+	}
+
+	// collect results
+	best_s := make([]int, npoints)
+	best_e := float64(1 << 32)
+
+	for i := 0; i < nwalkers; i++ {
+		res := <-results
+		if res.best_e < best_e {
+			best_e = res.best_e
+			copy(best_s, res.best_s)
+		}
+	}
+	wg.Wait()
+
+	// report results
+	if pr {
+		printRoute(best_s, prob.labels, isOpen(prob.dist))
+	}
+	writePerm(best_s, "./data/"+outFile)
+	fmt.Printf("Best distance found: %v (metric %s)\n", best_e, prob.metric)
+	fmt.Printf("Best route written to %s\n", "./data/"+outFile)
+	if tourFile != "" {
+		writeTour(best_s, tourFile)
+		fmt.Printf("Best tour written to %s\n", tourFile)
+	}
+	if opt_e > 0 {
+		reportGap(best_e, "optimum", opt_e)
+	}
+}
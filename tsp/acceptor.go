@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+/*
+Acceptance rules: given the energy delta of a proposal, the current and best
+energies and the temperature, decide whether to accept. The temperature is
+cooled by the walker's schedule whichever the rule, but only Metropolis and
+threshold accepting use it.
+
+  - "metropolis": downhill always, uphill with probability exp(-delta/T)
+  - "better": downhill only
+  - "threshold": threshold accepting (Dueck & Scheuer 1990), delta < T
+  - "deluge": great deluge (Dueck 1993), new energy below a water level that
+    starts at the initial energy and falls by the fixed amount rain on each
+    iteration: by default, in equal steps to the level floor (a lower bound on
+    the tour length, nearestBound) at the last of maxIter iterations. A reheat
+    starts a new level at the current energy, over the remaining iterations
+  - "rrt": record-to-record travel (Dueck 1993), new energy below the best
+    energy by at most the fraction deviation
+
+To add a rule, implement accept() and add a case to newAcceptor.
+*/
+type acceptor interface {
+	accept(delta float64, energy float64, best_e float64, temperature float64) bool
+}
+
+// acceptance rule by name, with parameters from annealParam; e0 the initial energy
+func newAcceptor(par annealParam, e0 float64) (acceptor, error) {
+
+	switch par.acceptor {
+	case "", "metropolis":
+		return metropolis{}, nil
+	case "better":
+		return better{}, nil
+	case "threshold":
+		return threshold{}, nil
+	case "deluge":
+		rain := par.rain
+		if rain <= 0 {
+			if par.maxIter <= 0 {
+				return nil, fmt.Errorf("great deluge needs rain > 0, or a nr of iterations")
+			}
+			// from the initial energy to the floor over the planned iterations
+			rain = math.Max(e0-par.floor, 0.0) / float64(par.maxIter)
+		}
+		return &deluge{level: e0, rain: rain}, nil
+	case "rrt":
+		if par.deviation <= 0 {
+			return nil, fmt.Errorf("record-to-record travel needs deviation > 0")
+		}
+		return rrt{deviation: par.deviation}, nil
+	}
+	return nil, fmt.Errorf("unknown acceptance rule %q", par.acceptor)
+}
+
+type metropolis struct{}
+
+func (a metropolis) accept(delta float64, energy float64, best_e float64, temperature float64) bool {
+	return delta < 0 || rand.Float64() < math.Exp(-delta/temperature)
+}
+
+type better struct{}
+
+func (a better) accept(delta float64, energy float64, best_e float64, temperature float64) bool {
+	return delta < 0
+}
+
+type threshold struct{}
+
+func (a threshold) accept(delta float64, energy float64, best_e float64, temperature float64) bool {
+	return delta < temperature
+}
+
+type deluge struct {
+	level float64
+	rain  float64
+}
+
+func (a *deluge) accept(delta float64, energy float64, best_e float64, temperature float64) bool {
+	ok := delta < 0 || energy+delta < a.level
+	a.level -= a.rain
+	return ok
+}
+
+type rrt struct {
+	deviation float64
+}
+
+func (a rrt) accept(delta float64, energy float64, best_e float64, temperature float64) bool {
+	return delta < 0 || energy+delta < best_e*(1+a.deviation)
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+/*
+Constructive initial tours:
+
+  - "nn": nearest neighbour from city 0
+  - "greedy": greedy edge matching on the 10 nearest neighbours of each city,
+    fragments then joined nearest-neighbour fashion
+  - "cheapest": cheapest insertion from city 0
+  - "farthest": farthest insertion from city 0 and the city farthest from it
+  - "hull": convex hull, then insertion of the city of least ratio
+    (d(a,k) + d(k,b)) / d(a,b) at its cheapest edge (a b)
+  - "hilbert": order along a Hilbert space-filling curve
+  - "christofides": minimum spanning tree plus a greedy matching of its odd
+    vertices, Euler tour shortcut
+
+hull and hilbert need point coordinates. All are roughly O(n^2) or better:
+insertion rescans a city whose cheapest edge is broken only when it would be
+chosen (at once, when choosing by ratio).
+*/
+
+// nr of nearest neighbours for greedy edges and matching
+const constructNeighbours = 10
+
+// initial tour by name ("random" or "": nil)
+func constructTour(name string, prob tspProblem) ([]int, error) {
+
+	switch name {
+	case "", "random":
+		return nil, nil
+	case "nn":
+		return nearestNeighbourTour(prob.dist), nil
+	case "greedy":
+		return greedyTour(prob), nil
+	case "cheapest":
+		return insertionTour(prob.dist, []int{0}, false), nil
+	case "farthest":
+		return farthestTour(prob.dist), nil
+	case "hull", "hilbert":
+		if prob.points == nil {
+			return nil, fmt.Errorf("initial tour %s needs point coordinates", name)
+		}
+		if name == "hull" {
+			return insertionTour(prob.dist, convexHull(prob.points), true), nil
+		}
+		return hilbertTour(prob.points), nil
+	case "christofides":
+		return christofidesTour(prob), nil
+	}
+	return nil, fmt.Errorf("unknown initial tour %q (random, nn, greedy, cheapest, farthest, hull, hilbert, christofides)", name)
+}
+
+// initial tour from a constructor name, or from a TSPLIB tour or route file
+func initialTour(init string, prob tspProblem) ([]int, error) {
+
+	tour, err := constructTour(init, prob)
+	if err != nil && isFile(init) {
+		return readProblemTour(init, prob)
+	}
+	return tour, err
+}
+
+// a walker's starting state: a copy of the initial tour, or random if nil,
+// with the fixed cities of an open path at its ends, or no empty tour of an mTSP
+func startTour(tour []int, prob tspProblem) []int {
+
+	n := prob.dist.size()
+	state := rand.Perm(n)
+	if tour != nil {
+		copy(state, tour)
+	}
+	if d, ok := prob.dist.(openDist); ok {
+		d.fixEnds(state)
+	}
+	if d, ok := prob.dist.(mtspDist); ok {
+		d.fillTours(state)
+	}
+	return state
+}
+
+func nearestNeighbourTour(dist distOracle) []int {
+
+	n := dist.size()
+	visited := make([]bool, n)
+	tour := make([]int, 0, n)
+	c := 0
+	for len(tour) < n {
+		visited[c] = true
+		tour = append(tour, c)
+		next, best := -1, math.Inf(1)
+		for j := 0; j < n; j++ {
+			if !visited[j] && dist.at(c, j) < best {
+				next, best = j, dist.at(c, j)
+			}
+		}
+		c = next
+	}
+	return tour
+}
+
+// disjoint sets of cities
+type unionFind []int
+
+func newUnionFind(n int) unionFind {
+	uf := make(unionFind, n)
+	for i := range uf {
+		uf[i] = i
+	}
+	return uf
+}
+
+func (uf unionFind) find(i int) int {
+	for uf[i] != i {
+		uf[i] = uf[uf[i]]
+		i = uf[i]
+	}
+	return i
+}
+
+func (uf unionFind) union(i int, j int) {
+	uf[uf.find(i)] = uf.find(j)
+}
+
+func greedyTour(prob tspProblem) []int {
+
+	n := prob.dist.size()
+	if n < 3 {
+		return nearestNeighbourTour(prob.dist)
+	}
+	type cand struct {
+		a, b int
+		d    float64
+	}
+	var cands []cand
+	for a, nb := range neighbourLists(prob, constructNeighbours) {
+		for _, b := range nb {
+			cands = append(cands, cand{a, b, prob.dist.at(a, b)})
+		}
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].d < cands[j].d })
+
+	// edges joining fragments, each city of degree at most 2
+	adj := make([][]int, n)
+	uf := newUnionFind(n)
+	for _, c := range cands {
+		if len(adj[c.a]) < 2 && len(adj[c.b]) < 2 && uf.find(c.a) != uf.find(c.b) {
+			adj[c.a] = append(adj[c.a], c.b)
+			adj[c.b] = append(adj[c.b], c.a)
+			uf.union(c.a, c.b)
+		}
+	}
+	return joinFragments(prob.dist, adj)
+}
+
+// join path fragments (adjacency lists, degree <= 2, no cycles) into a tour,
+// each fragment followed by the one with the nearest end
+func joinFragments(dist distOracle, adj [][]int) []int {
+
+	n := len(adj)
+	visited := make([]bool, n)
+	var frags [][]int
+	for c := 0; c < n; c++ {
+		if visited[c] || len(adj[c]) == 2 {
+			continue
+		}
+		// walk the path from an end
+		frag := []int{c}
+		visited[c] = true
+		for prev, cur := -1, c; ; {
+			next := -1
+			for _, x := range adj[cur] {
+				if x != prev {
+					next = x
+				}
+			}
+			if next < 0 {
+				break
+			}
+			frag = append(frag, next)
+			visited[next] = true
+			prev, cur = cur, next
+		}
+		frags = append(frags, frag)
+	}
+
+	tour := make([]int, 0, n)
+	used := make([]bool, len(frags))
+	f := 0
+	for k := 0; k < len(frags); k++ {
+		used[f] = true
+		tour = append(tour, frags[f]...)
+		tail := tour[len(tour)-1]
+		next, rev, best := -1, false, math.Inf(1)
+		for g, frag := range frags {
+			if used[g] {
+				continue
+			}
+			if d := dist.at(tail, frag[0]); d < best {
+				next, rev, best = g, false, d
+			}
+			if d := dist.at(tail, frag[len(frag)-1]); d < best {
+				next, rev, best = g, true, d
+			}
+		}
+		if next < 0 {
+			break
+		}
+		if rev {
+			reverseSlice(frags[next])
+		}
+		f = next
+	}
+	return tour
+}
+
+// insertion from a starting cycle: each city in turn at its cheapest edge,
+// choosing the city of least cost (or least ratio)
+func insertionTour(dist distOracle, start []int, ratio bool) []int {
+
+	n := dist.size()
+	next := make([]int, n)
+	inTour := make([]bool, n)
+	for i, c := range start {
+		next[c] = start[(i+1)%len(start)]
+		inTour[c] = true
+	}
+	cost := func(k int, a int) float64 {
+		return dist.at(a, k) + dist.at(k, next[a]) - dist.at(a, next[a])
+	}
+	// cheapest edge (a next[a]) for each city not in the tour. When that edge is
+	// broken the cost is kept as a lower bound (stale), and the city rescanned
+	// only if it would be chosen - unless choosing by ratio
+	bestA := make([]int, n)
+	bestC := make([]float64, n)
+	stale := make([]bool, n)
+	scan := func(k int) {
+		bestC[k], stale[k] = math.Inf(1), false
+		a := start[0]
+		for {
+			if c := cost(k, a); c < bestC[k] {
+				bestA[k], bestC[k] = a, c
+			}
+			a = next[a]
+			if a == start[0] {
+				break
+			}
+		}
+	}
+	for k := 0; k < n; k++ {
+		if !inTour[k] {
+			scan(k)
+		}
+	}
+
+	for m := len(start); m < n; m++ {
+		k := -1
+		for k < 0 || stale[k] {
+			if k >= 0 {
+				scan(k)
+			}
+			k = -1
+			best := math.Inf(1)
+			for j := 0; j < n; j++ {
+				if inTour[j] {
+					continue
+				}
+				c := bestC[j]
+				if ratio {
+					if d := dist.at(bestA[j], next[bestA[j]]); d > 0 {
+						c = (c + d) / d
+					}
+				}
+				if c < best {
+					k, best = j, c
+				}
+			}
+		}
+		// insert k after a, and update the cheapest edges of the others
+		a := bestA[k]
+		next[a], next[k] = k, next[a]
+		inTour[k] = true
+		for j := 0; j < n; j++ {
+			if inTour[j] {
+				continue
+			}
+			c, e := cost(j, a), a
+			if ck := cost(j, k); ck < c {
+				c, e = ck, k
+			}
+			switch {
+			case c < bestC[j] || (bestA[j] == a && !stale[j] && c <= bestC[j]):
+				bestA[j], bestC[j], stale[j] = e, c, false
+			case bestA[j] == a && ratio:
+				scan(j)
+			case bestA[j] == a:
+				stale[j] = true
+			}
+		}
+	}
+
+	tour := make([]int, 0, n)
+	for c := start[0]; len(tour) < n; c = next[c] {
+		tour = append(tour, c)
+	}
+	return tour
+}
+
+func farthestTour(dist distOracle) []int {
+
+	n := dist.size()
+	next := make([]int, n)
+	inTour := make([]bool, n)
+	// distance of each city to the tour
+	mind := make([]float64, n)
+	for j := range mind {
+		mind[j] = dist.at(0, j)
+	}
+	next[0] = 0
+	inTour[0] = true
+	for m := 1; m < n; m++ {
+		k, far := -1, -1.0
+		for j := 0; j < n; j++ {
+			if !inTour[j] && mind[j] > far {
+				k, far = j, mind[j]
+			}
+		}
+		// cheapest edge for k
+		a, best := 0, math.Inf(1)
+		for e := 0; ; {
+			if c := dist.at(e, k) + dist.at(k, next[e]) - dist.at(e, next[e]); c < best {
+				a, best = e, c
+			}
+			e = next[e]
+			if e == 0 {
+				break
+			}
+		}
+		next[a], next[k] = k, next[a]
+		inTour[k] = true
+		for j := 0; j < n; j++ {
+			mind[j] = math.Min(mind[j], dist.at(k, j))
+		}
+	}
+
+	tour := make([]int, 0, n)
+	for c := 0; len(tour) < n; c = next[c] {
+		tour = append(tour, c)
+	}
+	return tour
+}
+
+// convex hull, anticlockwise (Andrew's monotone chain)
+func convexHull(points [][2]float64) []int {
+
+	n := len(points)
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(a, b int) bool {
+		p, q := points[idx[a]], points[idx[b]]
+		return p[0] < q[0] || (p[0] == q[0] && p[1] < q[1])
+	})
+	cross := func(o, a, b int) float64 {
+		p, q, r := points[o], points[a], points[b]
+		return (q[0]-p[0])*(r[1]-p[1]) - (q[1]-p[1])*(r[0]-p[0])
+	}
+	hull := make([]int, 0, 2*n)
+	for pass := 0; pass < 2; pass++ {
+		lower := len(hull)
+		for k := 0; k < n; k++ {
+			i := idx[k]
+			if pass == 1 {
+				i = idx[n-1-k]
+			}
+			for len(hull) >= lower+2 && cross(hull[len(hull)-2], hull[len(hull)-1], i) <= 0 {
+				hull = hull[:len(hull)-1]
+			}
+			hull = append(hull, i)
+		}
+		// the last point of each chain is the first of the other
+		hull = hull[:len(hull)-1]
+	}
+	if len(hull) == 0 {
+		hull = append(hull, 0)
+	}
+	return hull
+}
+
+// order of points along a Hilbert curve on a 2^16 grid over their bounding box
+func hilbertTour(points [][2]float64) []int {
+
+	const order = 16
+	side := uint64(1) << order
+	lo, hi := points[0], points[0]
+	for _, p := range points {
+		for a := 0; a < 2; a++ {
+			lo[a] = math.Min(lo[a], p[a])
+			hi[a] = math.Max(hi[a], p[a])
+		}
+	}
+	scale := math.Max(hi[0]-lo[0], hi[1]-lo[1])
+	if scale == 0 {
+		scale = 1
+	}
+	keys := make([]uint64, len(points))
+	for i, p := range points {
+		x := uint64((p[0] - lo[0]) / scale * float64(side-1))
+		y := uint64((p[1] - lo[1]) / scale * float64(side-1))
+		keys[i] = hilbertIndex(side, x, y)
+	}
+	tour := make([]int, len(points))
+	for i := range tour {
+		tour[i] = i
+	}
+	sort.Slice(tour, func(a, b int) bool { return keys[tour[a]] < keys[tour[b]] })
+	return tour
+}
+
+// distance along the Hilbert curve of (x, y) in a side x side grid
+func hilbertIndex(side uint64, x uint64, y uint64) uint64 {
+
+	var d uint64
+	for s := side / 2; s > 0; s /= 2 {
+		var rx, ry uint64
+		if x&s > 0 {
+			rx = 1
+		}
+		if y&s > 0 {
+			ry = 1
+		}
+		d += s * s * ((3 * rx) ^ ry)
+		// rotate the quadrant
+		if ry == 0 {
+			if rx == 1 {
+				x, y = side-1-x, side-1-y
+			}
+			x, y = y, x
+		}
+	}
+	return d
+}
+
+// distances between a subset of cities
+type subDist struct {
+	dist distOracle
+	idx  []int
+}
+
+func (d subDist) at(i int, j int) float64 {
+	return d.dist.at(d.idx[i], d.idx[j])
+}
+
+func (d subDist) size() int {
+	return len(d.idx)
+}
+
+// minimum spanning tree (Prim), as parent of each city but the root 0
+func spanningTree(dist distOracle) []int {
+
+	n := dist.size()
+	parent := make([]int, n)
+	inTree := make([]bool, n)
+	mind := make([]float64, n)
+	for j := range mind {
+		mind[j] = math.Inf(1)
+	}
+	mind[0], parent[0] = 0, -1
+	for m := 0; m < n; m++ {
+		k, best := -1, math.Inf(1)
+		for j := 0; j < n; j++ {
+			if !inTree[j] && mind[j] < best {
+				k, best = j, mind[j]
+			}
+		}
+		inTree[k] = true
+		for j := 0; j < n; j++ {
+			if d := dist.at(k, j); !inTree[j] && d < mind[j] {
+				parent[j], mind[j] = k, d
+			}
+		}
+	}
+	return parent
+}
+
+func christofidesTour(prob tspProblem) []int {
+
+	n := prob.dist.size()
+	if n < 4 {
+		return nearestNeighbourTour(prob.dist)
+	}
+	// multigraph: spanning tree ...
+	adj := make([][]int, n)
+	for j, p := range spanningTree(prob.dist) {
+		if p >= 0 {
+			adj[j] = append(adj[j], p)
+			adj[p] = append(adj[p], j)
+		}
+	}
+	var odd []int
+	for c := range adj {
+		if len(adj[c])%2 == 1 {
+			odd = append(odd, c)
+		}
+	}
+
+	// ... plus a greedy matching of its odd vertices, on their nearest odd neighbours
+	sub := tspProblem{dist: subDist{dist: prob.dist, idx: odd}}
+	if prob.points != nil {
+		for _, c := range odd {
+			sub.points = append(sub.points, prob.points[c])
+		}
+	}
+	type cand struct {
+		a, b int
+		d    float64
+	}
+	var cands []cand
+	for a, nb := range neighbourLists(sub, constructNeighbours) {
+		for _, b := range nb {
+			cands = append(cands, cand{a, b, sub.dist.at(a, b)})
+		}
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].d < cands[j].d })
+	matched := make([]bool, len(odd))
+	match := func(a int, b int) {
+		matched[a], matched[b] = true, true
+		adj[odd[a]] = append(adj[odd[a]], odd[b])
+		adj[odd[b]] = append(adj[odd[b]], odd[a])
+	}
+	for _, c := range cands {
+		if !matched[c.a] && !matched[c.b] {
+			match(c.a, c.b)
+		}
+	}
+	for a := range odd {
+		if matched[a] {
+			continue
+		}
+		b, best := -1, math.Inf(1)
+		for x := range odd {
+			if x != a && !matched[x] && sub.dist.at(a, x) < best {
+				b, best = x, sub.dist.at(a, x)
+			}
+		}
+		match(a, b)
+	}
+
+	// Euler tour (Hierholzer), shortcutting repeated cities
+	used := make([][]bool, n)
+	for c := range adj {
+		used[c] = make([]bool, len(adj[c]))
+	}
+	ptr := make([]int, n)
+	visited := make([]bool, n)
+	tour := make([]int, 0, n)
+	stack := []int{0}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		for ptr[c] < len(adj[c]) && used[c][ptr[c]] {
+			ptr[c]++
+		}
+		if ptr[c] == len(adj[c]) {
+			stack = stack[:len(stack)-1]
+			if !visited[c] {
+				visited[c] = true
+				tour = append(tour, c)
+			}
+			continue
+		}
+		// use the edge (c x) in both directions
+		x := adj[c][ptr[c]]
+		used[c][ptr[c]] = true
+		for k, y := range adj[x] {
+			if y == c && !used[x][k] {
+				used[x][k] = true
+				break
+			}
+		}
+		stack = append(stack, x)
+	}
+	return tour
+}
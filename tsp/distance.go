@@ -1,15 +1,162 @@
 package main
 
 import (
+	"fmt"
 	"math"
+	"sort"
 )
 
+// a metric on the plane
+type metric func([2]float64, [2]float64) float64
+
+// metrics by name
+var metrics = map[string]metric{
+	"euclid":    distance,
+	"haversine": haversineDistance,
+	"manhattan": manhattanDistance,
+	"chebyshev": chebyshevDistance,
+	// TSPLIB rounded variants
+	"euc2d":  euc2dDistance,
+	"ceil2d": ceil2dDistance,
+	"man2d":  man2dDistance,
+	"max2d":  max2dDistance,
+	"att":    attDistance,
+	"geo":    geoDistance,
+}
+
+func getMetric(name string) (metric, error) {
+	m, ok := metrics[name]
+	if !ok {
+		var names []string
+		for k := range metrics {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown metric %q (one of %v)", name, names)
+	}
+	return m, nil
+}
+
 // compute L_2 distance
 func distance(p1 [2]float64, p2 [2]float64) float64 {
 	return math.Sqrt((p1[0]-p2[0])*(p1[0]-p2[0]) + (p1[1]-p2[1])*(p1[1]-p2[1]))
 }
 
-func distMatrix(points [][2]float64) [][]float64 {
+// compute L_1 distance
+func manhattanDistance(p1 [2]float64, p2 [2]float64) float64 {
+	return math.Abs(p1[0]-p2[0]) + math.Abs(p1[1]-p2[1])
+}
+
+// compute L_infinity distance
+func chebyshevDistance(p1 [2]float64, p2 [2]float64) float64 {
+	return math.Max(math.Abs(p1[0]-p2[0]), math.Abs(p1[1]-p2[1]))
+}
+
+// great-circle distance in km: points are (latitude, longitude) in degrees,
+// the column order of the city files
+func haversineDistance(p1 [2]float64, p2 [2]float64) float64 {
+	const earthRadius = 6371.0 // mean radius, km
+	const rad = math.Pi / 180.0
+	lat1, lat2 := p1[0]*rad, p2[0]*rad
+	sdlat := math.Sin((lat2 - lat1) / 2)
+	sdlong := math.Sin((p2[1] - p1[1]) * rad / 2)
+	a := sdlat*sdlat + math.Cos(lat1)*math.Cos(lat2)*sdlong*sdlong
+	return 2 * earthRadius * math.Asin(math.Min(1.0, math.Sqrt(a)))
+}
+
+// TSPLIB nearest integer
+func nint(x float64) float64 {
+	return math.Floor(x + 0.5)
+}
+
+// TSPLIB EUC_2D: L_2 distance rounded to nearest integer
+func euc2dDistance(p1 [2]float64, p2 [2]float64) float64 {
+	return nint(distance(p1, p2))
+}
+
+// TSPLIB CEIL_2D: L_2 distance rounded up
+func ceil2dDistance(p1 [2]float64, p2 [2]float64) float64 {
+	return math.Ceil(distance(p1, p2))
+}
+
+// TSPLIB MAN_2D: L_1 distance rounded to nearest integer
+func man2dDistance(p1 [2]float64, p2 [2]float64) float64 {
+	return nint(math.Abs(p1[0]-p2[0]) + math.Abs(p1[1]-p2[1]))
+}
+
+// TSPLIB MAX_2D: L_infinity distance rounded to nearest integer
+func max2dDistance(p1 [2]float64, p2 [2]float64) float64 {
+	return math.Max(nint(math.Abs(p1[0]-p2[0])), nint(math.Abs(p1[1]-p2[1])))
+}
+
+// TSPLIB ATT: pseudo-Euclidean distance (att48, att532)
+func attDistance(p1 [2]float64, p2 [2]float64) float64 {
+	r := math.Sqrt(((p1[0]-p2[0])*(p1[0]-p2[0]) + (p1[1]-p2[1])*(p1[1]-p2[1])) / 10.0)
+	t := nint(r)
+	if t < r {
+		return t + 1
+	}
+	return t
+}
+
+// TSPLIB GEO: coordinates are latitude, longitude in DDD.MM format,
+// distance in km on the TSPLIB idealised sphere
+func geoDistance(p1 [2]float64, p2 [2]float64) float64 {
+	const rrr = 6378.388
+	lat1, long1 := geoRadians(p1[0]), geoRadians(p1[1])
+	lat2, long2 := geoRadians(p2[0]), geoRadians(p2[1])
+	q1 := math.Cos(long1 - long2)
+	q2 := math.Cos(lat1 - lat2)
+	q3 := math.Cos(lat1 + lat2)
+	return math.Floor(rrr*math.Acos(0.5*((1.0+q1)*q2-(1.0-q1)*q3)) + 1.0)
+}
+func geoRadians(x float64) float64 {
+	const pi = 3.141592 // sic: TSPLIB's value
+	deg := math.Trunc(x)
+	min := x - deg
+	return pi * (deg + 5.0*min/3.0) / 180.0
+}
+
+/*
+Distance oracles: distances between cities by index.
+
+- denseDist: full N x N float64 matrix (fastest, 8N^2 bytes)
+- triDist: float32 lower-triangular matrix for symmetric metrics (2N^2 bytes)
+- lazyDist: computed on the fly from coordinates (no storage)
+
+newDistOracle chooses the backend by instance size. Explicit (e.g. asymmetric)
+distances are held in a denseDist.
+*/
+type distOracle interface {
+	at(i int, j int) float64
+	size() int
+}
+
+// instance size limits for the dense and triangular backends
+const (
+	denseLimit = 5000  // 200MB
+	triLimit   = 20000 // 800MB
+)
+
+func newDistOracle(points [][2]float64, d metric) distOracle {
+
+	npoints := len(points)
+	switch {
+	case npoints <= denseLimit:
+		return distMatrix(points, d)
+	case npoints <= triLimit:
+		return triMatrix(points, d)
+	default:
+		return lazyDist{points: points, d: d}
+	}
+}
+
+type denseDist [][]float64
+
+func (dist denseDist) at(i int, j int) float64 { return dist[i][j] }
+func (dist denseDist) size() int               { return len(dist) }
+
+func distMatrix(points [][2]float64, d metric) denseDist {
 
 	npoints := len(points)
 	// initialise distance matrix
@@ -20,19 +167,88 @@ func distMatrix(points [][2]float64) [][]float64 {
 	// compute distance matrix
 	for i := 0; i < npoints; i++ {
 		for j := 0; j < npoints; j++ {
-			dist[i][j] = distance(points[i], points[j])
+			dist[i][j] = d(points[i], points[j])
 		}
 	}
 	return dist
 }
 
-// total distance around a given route
-func travelDist(state []int, dist [][]float64) float64 {
+// row i holds d(i,0) ... d(i,i-1) at offset i(i-1)/2
+type triDist struct {
+	n    int
+	data []float32
+}
 
+func (dist triDist) at(i int, j int) float64 {
+	if i < j {
+		i, j = j, i
+	} else if i == j {
+		return 0.0
+	}
+	return float64(dist.data[i*(i-1)/2+j])
+}
+func (dist triDist) size() int { return dist.n }
+
+func triMatrix(points [][2]float64, d metric) triDist {
+
+	npoints := len(points)
+	dist := triDist{n: npoints, data: make([]float32, npoints*(npoints-1)/2)}
+	k := 0
+	for i := 1; i < npoints; i++ {
+		for j := 0; j < i; j++ {
+			dist.data[k] = float32(d(points[i], points[j]))
+			k++
+		}
+	}
+	return dist
+}
+
+type lazyDist struct {
+	points [][2]float64
+	d      metric
+}
+
+func (dist lazyDist) at(i int, j int) float64 { return dist.d(dist.points[i], dist.points[j]) }
+func (dist lazyDist) size() int               { return len(dist.points) }
+
+// whether d(i,j) = d(j,i) for all cities
+func isSymmetric(dist distOracle) bool {
+
+	n := dist.size()
+	for i := 0; i < n; i++ {
+		for j := 0; j < i; j++ {
+			if dist.at(i, j) != dist.at(j, i) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// symmetric lower envelope min(d(i,j), d(j,i)) of an asymmetric distance: a
+// tour is no shorter on it in either direction
+type minDist struct {
+	dist distOracle
+}
+
+func (d minDist) at(i int, j int) float64 { return math.Min(d.dist.at(i, j), d.dist.at(j, i)) }
+func (d minDist) size() int               { return d.dist.size() }
+
+// total distance around a given route (along it, if an open path; the longest
+// tour, if a min-max mTSP)
+func travelDist(state []int, dist distOracle) float64 {
+
+	if d, ok := dist.(mtspDist); ok && d.minmax {
+		return d.longest(state)
+	}
 	td := 0.0
 	np := len(state)
-	for i := range state {
-		td += dist[state[i%np]][state[(i+1)%np]]
+	links := np
+	if isOpen(dist) {
+		links = np - 1
+	}
+	for i := 0; i < links; i++ {
+		td += dist.at(state[i%np], state[(i+1)%np])
 	}
 	return td
 }
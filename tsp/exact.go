@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+/*
+Exact solvers, for ground truth on small instances:
+
+  - "dp": Held-Karp dynamic programme over subsets of cities, O(2^n n^2) time
+    and O(2^n n) memory, for n <= dpLimit
+  - "bb": branch and bound on the edges of the Held-Karp 1-tree (lowerbound.go).
+    Each node forces some edges in and others out (by adding -/+ bigM to their
+    cost), and its bound is the subgradient bound on those costs, warm-started
+    from its parent's penalties. A node whose 1-tree is a tour is solved;
+    otherwise it branches on a free 1-tree edge at a city of highest degree,
+    first forcing the edge in, then out. Forcing an edge in excludes the other
+    edges at a city with two forced edges, and the edge that would close a
+    forced path into a subtour. The first upper bound, which matters most, is
+    a greedy tour improved by iterated Lin-Kernighan (ils.go)
+
+"auto" chooses dp up to dpLimit cities, else bb. dp works on asymmetric
+problems, bb only on symmetric ones. bb is practical up to
+n ~ 100 on random Euclidean instances (more on easy ones, e.g. polygons).
+*/
+
+const (
+	dpLimit    = 20   // max nr of cities for the dynamic programme (80MB)
+	bbRootIter = 1000 // subgradient iterations at the root of branch and bound
+	bbNodeIter = 50   // ... and at the other nodes
+	bbKicks    = 100  // kicks per city of the iterated local search for the first upper bound
+)
+
+func checkExact(method string) error {
+
+	switch method {
+	case "auto", "dp", "bb":
+		return nil
+	}
+	return fmt.Errorf("unknown exact method %q (auto, dp or bb)", method)
+}
+
+// an optimal tour, by the given method
+func exactTour(method string, prob tspProblem) ([]int, error) {
+
+	if err := checkExact(method); err != nil {
+		return nil, err
+	}
+	n := prob.dist.size()
+	if method == "auto" {
+		method = "bb"
+		if n <= dpLimit {
+			method = "dp"
+		}
+	}
+	if n <= 3 {
+		tour := make([]int, n)
+		for i := range tour {
+			tour[i] = i
+		}
+		return tour, nil
+	}
+	if method == "dp" {
+		if n > dpLimit {
+			return nil, fmt.Errorf("dynamic programme limited to %d cities", dpLimit)
+		}
+		return dpTour(prob.dist), nil
+	}
+	if err := checkSymmetric(prob, "branch and bound"); err != nil {
+		return nil, err
+	}
+	return bbTour(prob), nil
+}
+
+// Held-Karp dynamic programme: shortest path from city 0 through each subset
+// of the others, ending at each city of the subset
+func dpTour(dist distOracle) []int {
+
+	n := dist.size()
+	m := n - 1 // cities 1..n-1 as bits 0..m-1
+	full := 1 << m
+	cost := make([]float64, full*m)
+	last := make([]int8, full*m) // previous city of the path
+	for k := range cost {
+		cost[k] = math.Inf(1)
+	}
+	for j := 0; j < m; j++ {
+		cost[(1<<j)*m+j] = dist.at(0, j+1)
+		last[(1<<j)*m+j] = -1
+	}
+	for mask := 1; mask < full; mask++ {
+		for j := 0; j < m; j++ {
+			c := cost[mask*m+j]
+			if mask&(1<<j) == 0 || math.IsInf(c, 1) {
+				continue
+			}
+			for k := 0; k < m; k++ {
+				if mask&(1<<k) != 0 {
+					continue
+				}
+				ix := (mask|1<<k)*m + k
+				if ck := c + dist.at(j+1, k+1); ck < cost[ix] {
+					cost[ix], last[ix] = ck, int8(j)
+				}
+			}
+		}
+	}
+
+	// close the tour, and trace it back
+	j, best := -1, math.Inf(1)
+	for k := 0; k < m; k++ {
+		if c := cost[(full-1)*m+k] + dist.at(k+1, 0); c < best {
+			j, best = k, c
+		}
+	}
+	tour := make([]int, n)
+	for mask, p := full-1, n-1; j >= 0; p-- {
+		tour[p] = j + 1
+		prev := int(last[mask*m+j])
+		mask &^= 1 << j
+		j = prev
+	}
+	return tour
+}
+
+type branchBound struct {
+	dist   distOracle
+	bigM   float64
+	best_s []int
+	best_e float64
+	nodes  int
+}
+
+func bbTour(prob tspProblem) []int {
+
+	n := prob.dist.size()
+	tour := greedyTour(prob)
+	kickTour("lk", tour, prob, nil, bbKicks*n)
+	bb := branchBound{
+		dist:   prob.dist,
+		best_s: tour,
+		best_e: travelDist(tour, prob.dist)}
+	// larger than any change of 1-tree length by one edge
+	bb.bigM = 4.0 * bb.best_e
+
+	// edge costs and status (1 forced in, -1 out)
+	cost := make(denseDist, n)
+	status := make([][]int8, n)
+	for i := range cost {
+		cost[i] = make([]float64, n)
+		status[i] = make([]int8, n)
+		for j := range cost[i] {
+			cost[i][j] = prob.dist.at(i, j)
+		}
+	}
+	bb.solve(cost, status, 0, make([]float64, n), bbRootIter)
+	return bb.best_s
+}
+
+// a node of nforced edges forced in, from penalties pi
+func (bb *branchBound) solve(cost denseDist, status [][]int8, nforced int, pi []float64, iters int) {
+
+	bb.nodes++
+	n := len(cost)
+	shift := bb.bigM * float64(nforced)
+	w, tree, isTour := subgradient(cost, pi, bb.best_e-shift, iters)
+	if w+shift >= bb.best_e-optEpsilon {
+		return
+	}
+	if isTour {
+		// optimal for this node (a tour breaking its constraints has a bound above)
+		tour := edgesTour(tree, n)
+		if e := travelDist(tour, bb.dist); e < bb.best_e {
+			bb.best_e, bb.best_s = e, tour
+		}
+		return
+	}
+
+	// a free 1-tree edge at a city of highest degree, the longest there
+	deg := make([]int, n)
+	for _, e := range tree {
+		deg[e[0]]++
+		deg[e[1]]++
+	}
+	v := 0
+	for j := range deg {
+		if deg[j] > deg[v] {
+			v = j
+		}
+	}
+	br := edge{-1, -1}
+	for _, e := range tree {
+		if (e[0] == v || e[1] == v) && status[e[0]][e[1]] == 0 &&
+			(br[0] < 0 || bb.dist.at(e[0], e[1]) > bb.dist.at(br[0], br[1])) {
+			br = e
+		}
+	}
+	if br[0] < 0 {
+		return
+	}
+
+	// forced in, then out
+	c, s := copyNode(cost, status)
+	bb.force(c, s, br[0], br[1])
+	bb.solve(c, s, nforced+1, append([]float64(nil), pi...), bbNodeIter)
+	c, s = copyNode(cost, status)
+	bb.exclude(c, s, br[0], br[1])
+	bb.solve(c, s, nforced, append([]float64(nil), pi...), bbNodeIter)
+}
+
+func copyNode(cost denseDist, status [][]int8) (denseDist, [][]int8) {
+
+	c := make(denseDist, len(cost))
+	s := make([][]int8, len(status))
+	for i := range cost {
+		c[i] = append([]float64(nil), cost[i]...)
+		s[i] = append([]int8(nil), status[i]...)
+	}
+	return c, s
+}
+
+func (bb *branchBound) exclude(cost denseDist, status [][]int8, a int, b int) {
+	status[a][b], status[b][a] = -1, -1
+	cost[a][b] += bb.bigM
+	cost[b][a] = cost[a][b]
+}
+
+// force edge (a b) in, excluding the edges it rules out
+func (bb *branchBound) force(cost denseDist, status [][]int8, a int, b int) {
+
+	n := len(cost)
+	status[a][b], status[b][a] = 1, 1
+	cost[a][b] -= bb.bigM
+	cost[b][a] = cost[a][b]
+
+	forced := func(c int) []int {
+		var nb []int
+		for j := 0; j < n; j++ {
+			if status[c][j] == 1 {
+				nb = append(nb, j)
+			}
+		}
+		return nb
+	}
+	// cities with two forced edges take no others
+	for _, c := range []int{a, b} {
+		if len(forced(c)) == 2 {
+			for j := 0; j < n; j++ {
+				if j != c && status[c][j] == 0 {
+					bb.exclude(cost, status, c, j)
+				}
+			}
+		}
+	}
+	// the ends of the forced path through (a b) may not be joined early
+	end := func(c int, from int) (int, int) {
+		k := 1
+		for {
+			next := -1
+			for _, j := range forced(c) {
+				if j != from {
+					next = j
+				}
+			}
+			if next < 0 {
+				return c, k
+			}
+			c, from, k = next, c, k+1
+		}
+	}
+	ea, ka := end(a, b)
+	eb, kb := end(b, a)
+	if ka+kb < n && status[ea][eb] == 0 {
+		bb.exclude(cost, status, ea, eb)
+	}
+}
+
+// the tour through the edges of a 1-tree with all degrees 2
+func edgesTour(edges []edge, n int) []int {
+
+	adj := make([][]int, n)
+	for _, e := range edges {
+		adj[e[0]] = append(adj[e[0]], e[1])
+		adj[e[1]] = append(adj[e[1]], e[0])
+	}
+	tour := make([]int, 0, n)
+	prev, c := -1, 0
+	for len(tour) < n {
+		tour = append(tour, c)
+		next := adj[c][0]
+		if next == prev {
+			next = adj[c][1]
+		}
+		prev, c = c, next
+	}
+	return tour
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+/*
+Iterated local search - returns best energy and best state.
+
+  - local optimum by local search (localopt.go), from the walker's initial state
+  - kick: random double-bridge, then local search from the 8 cities at its cuts
+  - the kicked optimum replaces the current one by the walker's acceptance rule
+    (acceptor.go), e.g. "better", or "metropolis" for annealing-like acceptance,
+    with the temperature cooled by the schedule once per period of kicks
+  - stops after maxIter kicks, countdown kicks without improvement, or the
+    wall-clock budget
+  - run parallel walkers as go routines, reporting as search()
+*/
+func (w tspWalker) iteratedLocalSearch(results chan<- packet) {
+
+	prob := w.problem
+	par := w.param
+	npoints := prob.dist.size()
+
+	start := time.Now()
+	nbrs := w.neighbours
+	if nbrs == nil {
+		nbrs = neighbourLists(prob, optNeighbours)
+	}
+	lo, _ := newLocalOpt(par.localSearch, w.state, prob.dist, nbrs)
+	lo.run(nil)
+
+	energy := travelDist(w.state, prob.dist)
+	best_e := energy
+	sched, acc := walkerRules(par, energy)
+	accepted := 0
+	result_ct := 0
+	var stats energyStats
+	// current local optimum, to return to when a kick is rejected
+	current := make([]int, npoints)
+	copy(current, w.state)
+	best_s := make([]int, npoints)
+	copy(best_s, w.state)
+
+	for kick := 1; kick < par.maxIter && npoints >= 8; kick++ {
+
+		if par.budget > 0 && time.Since(start) > par.budget {
+			break
+		}
+		new_e := energy + lo.kick()
+
+		// accept, or return to the current optimum
+		improved := false
+		if acc.accept(new_e-energy, energy, best_e, par.temperature) {
+			energy = new_e
+			copy(current, w.state)
+			accepted++
+			if energy < best_e {
+				best_e = energy
+				copy(best_s, w.state)
+				improved = true
+			}
+		} else {
+			copy(w.state, current)
+		}
+		stats.add(energy)
+
+		// check countdown
+		if improved {
+			result_ct = 0
+		} else {
+			result_ct++
+		}
+		if result_ct >= par.countdown {
+			break
+		}
+
+		// report progress, and cool
+		if kick%par.period == 0 {
+			if w.verbose {
+				fmt.Printf("%6d: temperature %v, acceptance %v best dist %v\n",
+					kick,
+					par.temperature,
+					float64(accepted)/float64(par.period),
+					best_e)
+			}
+			par.temperature = sched.next(par.temperature, stats.period(kick/par.period, accepted, best_e))
+			accepted = 0
+		}
+	}
+	runtime := time.Since(start)
+	distance := travelDist(best_s, prob.dist)
+	fmt.Printf("Found distance %v in time %v\n", distance, runtime)
+
+	// send data packet back to client
+	var res packet
+	res.best_s = make([]int, npoints)
+	res.id = w.id
+	res.best_e = best_e
+	copy(res.best_s, best_s)
+	results <- res
+}
+
+// random double-bridge kick of the tour (at least 8 cities), locally optimised
+// again from the 8 cities at its cuts: returns the change of length
+func (lo *localOpt) kick() float64 {
+
+	np := len(lo.tour)
+	idx := make([]int, 4)
+	for {
+		for k := range idx {
+			idx[k] = rand.Intn(np)
+		}
+		if _, ok := sortIndices(idx); ok {
+			break
+		}
+	}
+	cities := make([]int, 0, 8)
+	for _, p := range idx {
+		cities = append(cities, lo.tour[p], lo.tour[(p+1)%np])
+	}
+	delta := doubleBridgeDelta(idx, lo.tour, lo.dist)
+	doubleBridge(idx, lo.tour)
+	lo.reset()
+	return delta - lo.run(cities)
+}
+
+// iterated local search of a tour in place, keeping only improving kicks:
+// returns the gain
+func kickTour(method string, tour []int, prob tspProblem, nbrs [][]int, kicks int) (float64, error) {
+
+	if err := checkSymmetric(prob, "local search"); err != nil {
+		return 0.0, err
+	}
+	if nbrs == nil {
+		nbrs = neighbourLists(prob, optNeighbours)
+	}
+	lo, err := newLocalOpt(method, tour, prob.dist, nbrs)
+	if err != nil {
+		return 0.0, err
+	}
+	gain := lo.run(nil)
+	if len(tour) < 8 {
+		return gain, nil
+	}
+	current := make([]int, len(tour))
+	copy(current, tour)
+	for k := 0; k < kicks; k++ {
+		if delta := lo.kick(); delta < -optEpsilon {
+			gain -= delta
+			copy(current, tour)
+		} else {
+			copy(tour, current)
+			lo.reset()
+		}
+	}
+	return gain, nil
+}
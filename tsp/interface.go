@@ -1,10 +1,14 @@
 package main
 
+import "time"
+
 // specification of the TSP problem
 type tspProblem struct {
-	points [][2]float64
-	labels []string
-	dist   [][]float64
+	points     [][2]float64
+	labels     []string
+	dist       distOracle
+	metric     string
+	asymmetric bool // d(a,b) != d(b,a) for some cities (ATSP)
 }
 
 // parameters for explore/search
@@ -16,17 +20,59 @@ type annealParam struct {
 	srate       int
 	maxIter     int
 	countdown   int
+	budget      time.Duration // wall-clock limit (0: none)
+	// acceptance rule (acceptor.go)
+	acceptor  string  // "", "metropolis", "better", "threshold", "deluge" or "rrt"
+	rain      float64 // fall of the water level per iteration (deluge)
+	floor     float64 // final water level, by default (deluge)
+	deviation float64 // fraction above best energy (rrt)
+	// iterated local search
+	localSearch string // "2opt", "oropt" or "lk"
+	// tabu search
+	tenure     int // nr iterations a removed edge stays tabu
+	candidates int // nr sampled candidate moves per iteration (0: full neighbourhood)
+	// reheating on stagnation (search)
+	reheat     string  // "", "best", "current" (to reheatFrac T0) or "restart" (best state, T0)
+	reheatFrac float64 // fraction of initial temperature
+	maxReheats int
+	stagnation int // nr periods without improvement before reheating
+	// schedule parameters
+	nperiods  int     // planned nr of periods (linear, exp)
+	tempFinal float64 // final temperature (linear, exp)
+	alpha     float64 // exponential-in-time rate
+	beta      float64 // Lundy-Mees
+	lambda    float64 // Huang-Romeo-Sangiovanni-Vincentelli
+	acc0      float64 // initial target acceptance (target)
+	acc1      float64 // final target acceptance (target)
+	gain      float64 // feedback gain (target)
+}
+
+// a move class acts on a permutation via a tuple of indices
+type moveClass struct {
+	name      string
+	arity     int                                    // nr of indices in a proposal
+	variants  int                                    // nr of variants, drawn as the last index (0: none)
+	move      func([]int, []int)                     // (indices, perm)
+	delta     func([]int, []int, distOracle) float64 // (indices, perm, dist)
+	symmetric bool                                   // delta assumes d(a,b) = d(b,a)
+}
+
+// mixture of move classes with proposal weights
+type moveMix struct {
+	classes []moveClass
+	weights []float64
+	adapt   string // adaptive re-weighting: "", "acc" or "imp"
 }
 
 // structure of a walker
 type tspWalker struct {
-	id      int
-	problem tspProblem
-	param   annealParam
-	state   []int
-	move    func(int, int, []int)
-	delta   func(int, int, []int, [][]float64) float64
-	verbose bool
+	id         int
+	problem    tspProblem
+	param      annealParam
+	state      []int
+	moves      moveMix
+	neighbours [][]int // candidate lists for proposals (nil: uniform)
+	verbose    bool
 }
 
 // each walker will send back data packets
@@ -34,6 +80,9 @@ type packet struct {
 	id          int
 	temperature float64
 	energy      []float64
+	acceptance  []float64 // per move class
+	rung        int       // rung of the temperature ladder (parallel tempering)
+	exchanged   bool      // replica exchanged at the end of the period
 	best_e      float64
 	best_s      []int
 }
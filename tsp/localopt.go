@@ -0,0 +1,387 @@
+package main
+
+import (
+	"fmt"
+)
+
+/*
+Deterministic local search on a tour, with neighbour lists and don't-look bits:
+
+- "2opt": 2-opt moves (t1 t2)(t4 t3) -> (t2 t3)(t1 t4), t3 a neighbour of t2
+- "oropt": 2-opt, and Or-opt moves of segments of 1-3 cities reinserted, either
+  way round, next to a neighbour of one of their ends
+- "lk": Or-opt, and Lin-Kernighan style variable-depth moves: chains of up to
+  lkDepth sequential 2-opt steps from t1, each breaking the edge closing the
+  last (t1 t2i), kept up to the step of best closed gain. All first steps are
+  tried, later steps chosen greedily on the partial gain
+
+Cities whose neighbourhood gave no improvement are marked don't-look until an
+edge at them changes. run() works from a given set of active cities, so that an
+iterated scheme can re-optimise after a kick from the cities it touched.
+*/
+
+const (
+	lkDepth    = 5     // max nr of steps in an LK chain
+	optEpsilon = 1e-10 // minimum gain of an improving move
+)
+
+type localOpt struct {
+	method string
+	dist   distOracle
+	nbrs   [][]int
+	tour   []int // the tour, optimised in place
+	pos    []int // positions of cities in the tour
+	dlb    []bool
+	queue  []int
+}
+
+// nr of nearest neighbours for local search when no lists are given
+const optNeighbours = 10
+
+func checkLocalOpt(method string) error {
+
+	switch method {
+	case "2opt", "oropt", "lk":
+		return nil
+	}
+	return fmt.Errorf("unknown local search %q (2opt, oropt or lk)", method)
+}
+
+func newLocalOpt(method string, tour []int, dist distOracle, nbrs [][]int) (*localOpt, error) {
+
+	if err := checkLocalOpt(method); err != nil {
+		return nil, err
+	}
+	lo := localOpt{
+		method: method,
+		dist:   dist,
+		nbrs:   nbrs,
+		tour:   tour,
+		pos:    make([]int, len(tour)),
+		dlb:    make([]bool, len(tour))}
+	lo.reset()
+	return &lo, nil
+}
+
+// locally optimise a tour in place (e.g. the best state of annealing), with
+// neighbour lists (nil: the problem's nearest neighbours): returns the gain
+func polishTour(method string, tour []int, prob tspProblem, nbrs [][]int) (float64, error) {
+
+	if err := checkSymmetric(prob, "local search"); err != nil {
+		return 0.0, err
+	}
+	if nbrs == nil {
+		nbrs = neighbourLists(prob, optNeighbours)
+	}
+	lo, err := newLocalOpt(method, tour, prob.dist, nbrs)
+	if err != nil {
+		return 0.0, err
+	}
+	return lo.run(nil), nil
+}
+
+// recompute positions after the tour is changed from outside
+func (lo *localOpt) reset() {
+	for p, c := range lo.tour {
+		lo.pos[c] = p
+	}
+}
+
+func (lo *localOpt) succ(c int) int {
+	return lo.tour[(lo.pos[c]+1)%len(lo.tour)]
+}
+
+func (lo *localOpt) pred(c int) int {
+	np := len(lo.tour)
+	return lo.tour[(lo.pos[c]+np-1)%np]
+}
+
+// activate cities (clear their don't-look bits)
+func (lo *localOpt) activate(cities ...int) {
+	for _, c := range cities {
+		if lo.dlb[c] {
+			lo.dlb[c] = false
+			lo.queue = append(lo.queue, c)
+		}
+	}
+}
+
+// optimise from the given active cities (nil: all), returning the total gain
+func (lo *localOpt) run(cities []int) float64 {
+
+	np := len(lo.tour)
+	if np < 5 {
+		return 0.0
+	}
+	lo.queue = lo.queue[:0]
+	for c := range lo.dlb {
+		lo.dlb[c] = true
+	}
+	if cities == nil {
+		lo.activate(lo.tour...)
+	} else {
+		lo.activate(cities...)
+	}
+
+	gain := 0.0
+	for len(lo.queue) > 0 {
+		c := lo.queue[0]
+		lo.queue = lo.queue[1:]
+		for {
+			g := lo.improveCity(c)
+			if g <= 0 {
+				break
+			}
+			gain += g
+		}
+		lo.dlb[c] = true
+	}
+	return gain
+}
+
+// best improving move at a city, applied: returns its gain (0 if none)
+func (lo *localOpt) improveCity(t1 int) float64 {
+
+	switch lo.method {
+	case "2opt":
+		return lo.twoOpt(t1)
+	case "oropt":
+		if g := lo.twoOpt(t1); g > 0 {
+			return g
+		}
+		return lo.orOpt(t1)
+	}
+	if g := lo.linKernighan(t1); g > 0 {
+		return g
+	}
+	return lo.orOpt(t1)
+}
+
+// reverse the tour from city a forward to city b, updating positions
+func (lo *localOpt) reversePath(a int, b int) {
+
+	np := len(lo.tour)
+	i, j := lo.pos[a], lo.pos[b]
+	n := (j - i + np) % np
+	// reverse the shorter side (the tour is the same cycle either way)
+	if 2*(n+1) > np {
+		i, j = (j+1)%np, (i+np-1)%np
+		n = np - 2 - n
+	}
+	for k := 0; k < (n+1)/2; k++ {
+		p, q := (i+k)%np, (j-k+np)%np
+		lo.tour[p], lo.tour[q] = lo.tour[q], lo.tour[p]
+		lo.pos[lo.tour[p]] = p
+		lo.pos[lo.tour[q]] = q
+	}
+}
+
+// 2-opt move replacing edges (t1 t2)(t4 t3) by (t2 t3)(t1 t4), where t4 is on
+// the t2 side of t3 (t4 = pred(t3) if t2 = succ(t1), else succ(t3))
+func (lo *localOpt) apply2opt(t1 int, t2 int, t3 int, t4 int) {
+	if lo.succ(t1) == t2 {
+		lo.reversePath(t2, t4)
+	} else {
+		lo.reversePath(t1, t3)
+	}
+}
+
+// best 2-opt move at t1, over both its tour edges
+func (lo *localOpt) twoOpt(t1 int) float64 {
+
+	d := lo.dist.at
+	best := optEpsilon
+	var b2, b3, b4 int
+	for _, t2 := range []int{lo.succ(t1), lo.pred(t1)} {
+		d12 := d(t1, t2)
+		for _, t3 := range lo.nbrs[t2] {
+			d23 := d(t2, t3)
+			if d23 >= d12 {
+				break
+			}
+			t4 := lo.succ(t3)
+			if t2 == lo.succ(t1) {
+				t4 = lo.pred(t3)
+			}
+			if t3 == t1 || t4 == t2 {
+				continue
+			}
+			if g := d12 + d(t4, t3) - d23 - d(t1, t4); g > best {
+				best, b2, b3, b4 = g, t2, t3, t4
+			}
+		}
+	}
+	if best <= optEpsilon {
+		return 0.0
+	}
+	lo.apply2opt(t1, b2, b3, b4)
+	lo.activate(t1, b2, b3, b4)
+	return best
+}
+
+// best Or-opt move of a segment of 1-3 cities starting at s1
+func (lo *localOpt) orOpt(s1 int) float64 {
+
+	d := lo.dist.at
+	np := len(lo.tour)
+	best := optEpsilon
+	var bl, bc, be int
+	var brev bool
+	sL := s1
+	for l := 1; l <= 3 && l+2 < np; l++ {
+		if l > 1 {
+			sL = lo.succ(sL)
+		}
+		p, nx := lo.pred(s1), lo.succ(sL)
+		removal := d(p, s1) + d(sL, nx) - d(p, nx)
+		inSeg := func(c int) bool {
+			return (lo.pos[c]-lo.pos[s1]+np)%np < l
+		}
+		for _, end := range []int{s1, sL} {
+			for _, c := range lo.nbrs[end] {
+				if inSeg(c) {
+					continue
+				}
+				if d(c, end) >= removal {
+					break
+				}
+				// insert between c and either tour neighbour e
+				for _, e := range []int{lo.succ(c), lo.pred(c)} {
+					if inSeg(e) {
+						continue
+					}
+					// end next to c: the other end next to e
+					other := sL
+					if end == sL {
+						other = s1
+					}
+					g := removal + d(c, e) - d(c, end) - d(other, e)
+					if g > best {
+						best, bl, bc, be = g, l, c, e
+						// reversed in the tour direction unless s1 follows c, or sL precedes c
+						brev = (end == s1) != (e == lo.succ(c))
+					}
+				}
+			}
+		}
+	}
+	if best <= optEpsilon {
+		return 0.0
+	}
+	lo.moveSegment(s1, bl, bc, be, brev)
+	return best
+}
+
+// move the segment of l cities from s1 between the adjacent cities c and e,
+// reversed (relative to the tour direction) or not
+func (lo *localOpt) moveSegment(s1 int, l int, c int, e int, reversed bool) {
+
+	np := len(lo.tour)
+	seg := make([]int, l)
+	for k := range seg {
+		seg[k] = lo.tour[(lo.pos[s1]+k)%np]
+	}
+	p, nx := lo.pred(s1), lo.succ(seg[l-1])
+	if lo.succ(e) == c {
+		c, e = e, c
+	}
+	// now e follows c: rebuild the tour from nx, inserting the segment after c
+	tour := make([]int, 0, np)
+	for k, x := 0, nx; k < np-l; k, x = k+1, lo.succ(x) {
+		tour = append(tour, x)
+		if x == c {
+			if reversed {
+				for m := l - 1; m >= 0; m-- {
+					tour = append(tour, seg[m])
+				}
+			} else {
+				tour = append(tour, seg...)
+			}
+		}
+	}
+	copy(lo.tour, tour)
+	lo.reset()
+	lo.activate(p, nx, c, e, seg[0], seg[l-1])
+}
+
+// Lin-Kernighan style move at t1: each first step (t2 either tour neighbour,
+// t3 a neighbour of t2 closer than t1) continued greedily
+func (lo *localOpt) linKernighan(t1 int) float64 {
+
+	for _, t2 := range []int{lo.succ(t1), lo.pred(t1)} {
+		for _, t3 := range lo.nbrs[t2] {
+			if lo.dist.at(t2, t3) >= lo.dist.at(t1, t2) {
+				break
+			}
+			if g := lo.lkChain(t1, t2, t3); g > 0 {
+				return g
+			}
+		}
+	}
+	return 0.0
+}
+
+// t4 of a step from t1 t2 to t3, and whether the step is valid
+func (lo *localOpt) lkT4(t1 int, t2 int, t3 int) (int, bool) {
+	t4 := lo.succ(t3)
+	if lo.succ(t1) == t2 {
+		t4 = lo.pred(t3)
+	}
+	return t4, t3 != t1 && t4 != t2
+}
+
+// chain of 2-opt steps from t1 with first step to t3: kept up to the step of
+// best closed gain, returned (0, and the tour unchanged, if none improves)
+func (lo *localOpt) lkChain(t1 int, t2 int, t3 int) float64 {
+
+	d := lo.dist.at
+	var steps [][3]int // (t2, t3, t4) of the steps made, to undo
+	g := d(t1, t2)     // partial gain, with the edge (t1 t2) removed
+	best, bestDepth := optEpsilon, 0
+	for depth := 1; depth <= lkDepth; depth++ {
+		// t3 near t2 maximising g - d(t2 t3) + d(t4 t3)
+		bestStep := 0.0
+		var b3, b4 int
+		for _, c := range lo.nbrs[t2] {
+			if depth == 1 {
+				c = t3
+			}
+			g1 := g - d(t2, c)
+			if g1 <= 0 {
+				break
+			}
+			if t4, ok := lo.lkT4(t1, t2, c); ok {
+				if s := g1 + d(t4, c); s > bestStep {
+					bestStep, b3, b4 = s, c, t4
+				}
+			}
+			if depth == 1 {
+				break
+			}
+		}
+		if bestStep <= 0 {
+			break
+		}
+		// the closing edge (t1 t4) is broken by the next step
+		lo.apply2opt(t1, t2, b3, b4)
+		steps = append(steps, [3]int{t2, b3, b4})
+		g = bestStep
+		if closed := g - d(b4, t1); closed > best {
+			best, bestDepth = closed, depth
+		}
+		t2 = b4
+	}
+
+	// undo the steps after the best
+	for k := len(steps) - 1; k >= bestDepth; k-- {
+		lo.apply2opt(t1, steps[k][2], steps[k][1], steps[k][0])
+	}
+	if bestDepth == 0 {
+		return 0.0
+	}
+	lo.activate(t1)
+	for _, st := range steps[:bestDepth] {
+		lo.activate(st[0], st[1], st[2])
+	}
+	return best
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"math"
+)
+
+/*
+Held-Karp lower bound on the optimal tour length.
+
+A 1-tree is a spanning tree on cities 1..n-1 plus the two shortest edges at
+city 0: every tour is a 1-tree, so the minimum 1-tree is a lower bound. With
+node penalties pi added to the edges at each city, every tour length grows by
+exactly 2 sum(pi), so
+
+  w(pi) = min 1-tree length (penalised) - 2 sum(pi)
+
+is a lower bound for any pi. The bound is maximised over pi by subgradient
+ascent: pi += t (deg - 2), with step t = lambda (ub - w) / |deg - 2|^2 towards an
+upper bound ub (a known tour length), lambda halved when the bound hasn't
+improved for hkPatience iterations. If the 1-tree is a tour (all degrees 2)
+the bound is the optimum.
+
+Each iteration is a dense O(n^2) minimum spanning tree.
+*/
+
+const (
+	hkPatience = 10   // iterations without improvement before halving lambda
+	hkMinStep  = 1e-6 // stop when lambda falls below this
+)
+
+// minimum 1-tree with node penalties: returns its penalised length and its
+// edges, and sets the degree of each city
+func oneTree(dist distOracle, pi []float64, deg []int) (float64, []edge) {
+
+	n := dist.size()
+	cost := func(i int, j int) float64 {
+		return dist.at(i, j) + pi[i] + pi[j]
+	}
+	for j := range deg {
+		deg[j] = 0
+	}
+
+	// spanning tree on cities 1..n-1 (Prim)
+	inTree := make([]bool, n)
+	parent := make([]int, n)
+	mind := make([]float64, n)
+	for j := range mind {
+		mind[j] = math.Inf(1)
+	}
+	length := 0.0
+	tree := make([]edge, 0, n)
+	mind[1] = 0.0
+	for m := 1; m < n; m++ {
+		k, best := -1, math.Inf(1)
+		for j := 1; j < n; j++ {
+			if !inTree[j] && mind[j] < best {
+				k, best = j, mind[j]
+			}
+		}
+		inTree[k] = true
+		if m > 1 {
+			length += best
+			tree = append(tree, newEdge(k, parent[k]))
+			deg[k]++
+			deg[parent[k]]++
+		}
+		for j := 1; j < n; j++ {
+			if !inTree[j] {
+				if c := cost(k, j); c < mind[j] {
+					parent[j], mind[j] = k, c
+				}
+			}
+		}
+	}
+
+	// the two shortest edges at city 0
+	a, b := math.Inf(1), math.Inf(1)
+	ia, ib := -1, -1
+	for j := 1; j < n; j++ {
+		c := cost(0, j)
+		if c < a {
+			b, ib = a, ia
+			a, ia = c, j
+		} else if c < b {
+			b, ib = c, j
+		}
+	}
+	length += a + b
+	tree = append(tree, newEdge(0, ia), newEdge(0, ib))
+	deg[0] = 2
+	deg[ia]++
+	deg[ib]++
+	return length, tree
+}
+
+// Held-Karp bound by at most maxIter subgradient iterations, given an upper
+// bound (e.g. the best tour found) to scale the steps. An asymmetric problem
+// is bounded on min(d(a,b), d(b,a)) (weaker)
+func heldKarpBound(prob tspProblem, ub float64, maxIter int) float64 {
+
+	dist := prob.dist
+	if prob.asymmetric {
+		dist = minDist{dist: prob.dist}
+	}
+	if dist.size() < 3 {
+		return 0.0
+	}
+	pi := make([]float64, dist.size())
+	best_w, _, _ := subgradient(dist, pi, ub, maxIter)
+	// no higher than a known tour, up to rounding
+	return math.Min(best_w, ub)
+}
+
+// subgradient ascent from penalties pi, stopping early if the bound reaches
+// ub: returns the best bound, its 1-tree and whether that is a tour, with pi
+// set to the best penalties
+func subgradient(dist distOracle, pi []float64, ub float64, maxIter int) (float64, []edge, bool) {
+
+	n := dist.size()
+	deg := make([]int, n)
+	best_pi := make([]float64, n)
+	copy(best_pi, pi)
+	best_w := math.Inf(-1)
+	var best_tree []edge
+	isTour := false
+	lambda := 2.0
+	stuck := 0
+	for iter := 0; iter < maxIter && lambda > hkMinStep; iter++ {
+
+		w, tree := oneTree(dist, pi, deg)
+		norm := 0
+		for j := range pi {
+			w -= 2.0 * pi[j]
+			norm += (deg[j] - 2) * (deg[j] - 2)
+		}
+		if w > best_w || norm == 0 {
+			best_w, best_tree, isTour = w, tree, norm == 0
+			copy(best_pi, pi)
+			stuck = 0
+		} else {
+			stuck++
+			if stuck >= hkPatience {
+				lambda /= 2.0
+				stuck = 0
+			}
+		}
+		if norm == 0 || best_w >= ub {
+			// the 1-tree is a tour (optimal), or the bound is no use
+			break
+		}
+
+		// subgradient step
+		t := lambda * (ub - w) / float64(norm)
+		for j := range pi {
+			pi[j] += t * float64(deg[j]-2)
+		}
+	}
+	copy(pi, best_pi)
+	return best_w, best_tree, isTour
+}
+
+// a cheap lower bound on the tour length, in O(n^2): each city is left along
+// an edge no shorter than the one to its nearest neighbour (less the longest
+// such edge, if an open path; over the salesmen, if a min-max mTSP)
+func nearestBound(dist distOracle) float64 {
+
+	n := dist.size()
+	sum, longest := 0.0, 0.0
+	for i := 0; i < n; i++ {
+		near := math.Inf(1)
+		for j := 0; j < n; j++ {
+			if j != i {
+				near = math.Min(near, dist.at(i, j))
+			}
+		}
+		if n > 1 {
+			sum += near
+			longest = math.Max(longest, near)
+		}
+	}
+	if isOpen(dist) {
+		sum -= longest
+	}
+	if d, ok := dist.(mtspDist); ok && d.minmax {
+		sum /= float64(d.salesmen)
+	}
+	return sum
+}
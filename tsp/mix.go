@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+/*
+Mixed move-class proposals: each proposal picks one of several move classes
+with given probabilities. In adaptive mode the probabilities are re-weighted at
+the end of each period by the classes' acceptance ("acc") or improvement ("imp")
+rates over the period.
+*/
+
+// smoothing of adaptive weights, and floor as a fraction of the uniform weight
+const (
+	adaptRate  = 0.5
+	adaptFloor = 0.1
+)
+
+// parse comma-separated move class names and (optional) weights
+func parseMoveMix(names string, weights string, adapt string) (moveMix, error) {
+
+	var mix moveMix
+	for _, name := range strings.Split(names, ",") {
+		mc, err := getMoveClass(strings.TrimSpace(name))
+		if err != nil {
+			return mix, err
+		}
+		mix.classes = append(mix.classes, mc)
+	}
+	if weights == "" {
+		for range mix.classes {
+			mix.weights = append(mix.weights, 1.0)
+		}
+	} else {
+		for _, f := range strings.Split(weights, ",") {
+			wt, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+			if err != nil || wt < 0 || math.IsInf(wt, 1) || math.IsNaN(wt) {
+				return mix, fmt.Errorf("bad move class weight %q", f)
+			}
+			mix.weights = append(mix.weights, wt)
+		}
+	}
+	if len(mix.weights) != len(mix.classes) {
+		return mix, fmt.Errorf("%d move classes but %d weights", len(mix.classes), len(mix.weights))
+	}
+	sum := 0.0
+	for _, wt := range mix.weights {
+		sum += wt
+	}
+	if sum <= 0 {
+		return mix, fmt.Errorf("move class weights %q sum to zero", weights)
+	}
+	switch adapt {
+	case "", "acc", "imp":
+		mix.adapt = adapt
+	default:
+		return mix, fmt.Errorf("unknown adaptive mode %q (acc or imp)", adapt)
+	}
+	normalise(mix.weights)
+	return mix, nil
+}
+
+// mixture of a single move class
+func singleMove(mc moveClass) moveMix {
+	return moveMix{classes: []moveClass{mc}, weights: []float64{1.0}}
+}
+
+// largest arity of the classes
+func (mix moveMix) arity() int {
+	a := 0
+	for _, mc := range mix.classes {
+		if mc.arity > a {
+			a = mc.arity
+		}
+	}
+	return a
+}
+
+func normalise(weights []float64) {
+	sum := 0.0
+	for _, wt := range weights {
+		sum += wt
+	}
+	for k := range weights {
+		weights[k] /= sum
+	}
+}
+
+// per-walker proposal state: current weights and counts for the period
+type mixState struct {
+	mix      moveMix
+	weights  []float64
+	proposed []int
+	accepted []int
+	improved []int
+}
+
+func (mix moveMix) newState() *mixState {
+
+	nc := len(mix.classes)
+	ms := mixState{
+		mix:      mix,
+		weights:  make([]float64, nc),
+		proposed: make([]int, nc),
+		accepted: make([]int, nc),
+		improved: make([]int, nc)}
+	copy(ms.weights, mix.weights)
+	return &ms
+}
+
+// pick a move class
+func (ms *mixState) choose() int {
+
+	if len(ms.weights) == 1 {
+		return 0
+	}
+	u := rand.Float64()
+	for k, wt := range ms.weights {
+		if u < wt {
+			return k
+		}
+		u -= wt
+	}
+	return len(ms.weights) - 1
+}
+
+func (ms *mixState) record(k int, accepted bool, delta float64) {
+
+	ms.proposed[k]++
+	if accepted {
+		ms.accepted[k]++
+		if delta < 0 {
+			ms.improved[k]++
+		}
+	}
+}
+
+// acceptance rate per class over the period
+func (ms *mixState) acceptance() []float64 {
+
+	acc := make([]float64, len(ms.proposed))
+	for k := range acc {
+		if ms.proposed[k] > 0 {
+			acc[k] = float64(ms.accepted[k]) / float64(ms.proposed[k])
+		}
+	}
+	return acc
+}
+
+// summary for verbose output
+func (ms *mixState) String() string {
+
+	var sb strings.Builder
+	for k, acc := range ms.acceptance() {
+		if k > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "%s %.4f (w %.3f)", ms.mix.classes[k].name, acc, ms.weights[k])
+	}
+	return sb.String()
+}
+
+// end of period: re-weight if adaptive, reset counts
+func (ms *mixState) endPeriod() {
+
+	nc := len(ms.weights)
+	if ms.mix.adapt != "" && nc > 1 {
+		score := make([]float64, nc)
+		for k := range score {
+			n := ms.accepted[k]
+			if ms.mix.adapt == "imp" {
+				n = ms.improved[k]
+			}
+			// smoothed rate, so unproposed classes are not zeroed
+			score[k] = (float64(n) + 1.0) / (float64(ms.proposed[k]) + 2.0)
+		}
+		normalise(score)
+		floor := adaptFloor / float64(nc)
+		for k := range ms.weights {
+			ms.weights[k] = (1-adaptRate)*ms.weights[k] + adaptRate*score[k]
+			if ms.weights[k] < floor {
+				ms.weights[k] = floor
+			}
+		}
+		normalise(ms.weights)
+	}
+	for k := range ms.proposed {
+		ms.proposed[k], ms.accepted[k], ms.improved[k] = 0, 0, 0
+	}
+}
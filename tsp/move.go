@@ -1,5 +1,88 @@
 package main
 
+import (
+	"fmt"
+)
+
+// move classes by name
+func getMoveClass(name string) (moveClass, error) {
+
+	switch name {
+	case "reverse":
+		mc := pairMove(name, reverse, reverseDelta)
+		mc.symmetric = true
+		return mc, nil
+	case "swap":
+		return pairMove(name, swap, swapDelta), nil
+	case "oropt":
+		mc := variantMove(name, 6, orOpt, orOptDelta)
+		mc.symmetric = true
+		return mc, nil
+	case "shift":
+		return variantMove(name, 3, shift, shiftDelta), nil
+	case "3opt":
+		return moveClass{name: name, arity: 4, variants: 7, move: threeOpt, delta: threeOptDelta, symmetric: true}, nil
+	case "exchange":
+		return moveClass{name: name, arity: 3, move: exchange, delta: exchangeDelta}, nil
+	case "bridge":
+		return moveClass{name: name, arity: 4, move: doubleBridge, delta: doubleBridgeDelta}, nil
+	}
+	return moveClass{}, fmt.Errorf("unknown move class %q (one of reverse, swap, oropt, shift, 3opt, exchange, bridge)", name)
+}
+
+/*
+Move classes for an asymmetric (ATSP) problem. Reversing a chain changes the
+direction of every edge inside it: reverse gets a delta summing over the chain,
+O(chain length). The direction-preserving classes (swap, shift, exchange,
+bridge) are unchanged, and the other classes, which reverse segments as one of
+their variants, are rejected.
+*/
+func asymmetricMoves(mix moveMix) (moveMix, error) {
+
+	classes := make([]moveClass, len(mix.classes))
+	for k, mc := range mix.classes {
+		switch {
+		case mc.name == "reverse":
+			mc = pairMove(mc.name, reverse, reverseDeltaAsym)
+		case mc.symmetric:
+			return mix, fmt.Errorf("move class %s needs a symmetric distance (for asymmetric: reverse, swap, shift, exchange, bridge)", mc.name)
+		}
+		classes[k] = mc
+	}
+	mix.classes = classes
+	return mix, nil
+}
+
+// move class from a 2-index move and its delta
+func pairMove(name string, move func(int, int, []int), delta func(int, int, []int, distOracle) float64) moveClass {
+
+	return moveClass{
+		name:  name,
+		arity: 2,
+		move: func(idx []int, perm []int) {
+			move(idx[0], idx[1], perm)
+		},
+		delta: func(idx []int, perm []int, dist distOracle) float64 {
+			return delta(idx[0], idx[1], perm, dist)
+		}}
+}
+
+// move class from a 2-index move of some variants and its delta: a proposal
+// is the 2 indices and the variant
+func variantMove(name string, variants int, move func(int, int, int, []int), delta func(int, int, int, []int, distOracle) float64) moveClass {
+
+	return moveClass{
+		name:     name,
+		arity:    3,
+		variants: variants,
+		move: func(idx []int, perm []int) {
+			move(idx[0], idx[1], idx[2], perm)
+		},
+		delta: func(idx []int, perm []int, dist distOracle) float64 {
+			return delta(idx[0], idx[1], idx[2], perm, dist)
+		}}
+}
+
 // 2-bond move class: reverse the subchain between 2 indices
 func reverse(i int, j int, perm []int) {
 	switch i < j {
@@ -16,7 +99,7 @@ func reverseSlice(s []int) {
 }
 
 // energy delta for 2-bond reverse
-func reverseDelta(i int, j int, perm []int, dist [][]float64) float64 {
+func reverseDelta(i int, j int, perm []int, dist distOracle) float64 {
 	np := len(perm)
 	if i == j || (i == 0 && j == np-1) || (j == 0 && i == np-1) {
 		return 0.0
@@ -25,16 +108,37 @@ func reverseDelta(i int, j int, perm []int, dist [][]float64) float64 {
 	switch i < j {
 	case true:
 		// i before j
-		dd -= dist[perm[j%np]][perm[(j+1)%np]]
-		dd -= dist[perm[(np+i-1)%np]][perm[i%np]]
-		dd += dist[perm[(np+i-1)%np]][perm[j%np]]
-		dd += dist[perm[i%np]][perm[(j+1)%np]]
+		dd -= dist.at(perm[j%np], perm[(j+1)%np])
+		dd -= dist.at(perm[(np+i-1)%np], perm[i%np])
+		dd += dist.at(perm[(np+i-1)%np], perm[j%np])
+		dd += dist.at(perm[i%np], perm[(j+1)%np])
 	case false:
 		// j before i
-		dd -= dist[perm[i%np]][perm[(i+1)%np]]
-		dd -= dist[perm[(np+j-1)%np]][perm[j%np]]
-		dd += dist[perm[(np+j-1)%np]][perm[i%np]]
-		dd += dist[perm[j%np]][perm[(i+1)%np]]
+		dd -= dist.at(perm[i%np], perm[(i+1)%np])
+		dd -= dist.at(perm[(np+j-1)%np], perm[j%np])
+		dd += dist.at(perm[(np+j-1)%np], perm[i%np])
+		dd += dist.at(perm[j%np], perm[(i+1)%np])
+	}
+	return dd
+}
+
+// energy delta for 2-bond reverse on an asymmetric problem: the end edges, and
+// the reversed edges inside the chain
+func reverseDeltaAsym(i int, j int, perm []int, dist distOracle) float64 {
+	np := len(perm)
+	if i > j {
+		i, j = j, i
+	}
+	if i == j {
+		return 0.0
+	}
+	dd := reverseDelta(i, j, perm, dist)
+	for k := i; k < j; k++ {
+		dd += dist.at(perm[k+1], perm[k]) - dist.at(perm[k], perm[k+1])
+	}
+	if i == 0 && j == np-1 {
+		// the whole tour: the closing edge is reversed too
+		dd += dist.at(perm[0], perm[np-1]) - dist.at(perm[np-1], perm[0])
 	}
 	return dd
 }
@@ -47,7 +151,7 @@ func swap(i int, j int, perm []int) {
 }
 
 // energy delta for swap
-func swapDelta(i int, j int, perm []int, dist [][]float64) float64 {
+func swapDelta(i int, j int, perm []int, dist distOracle) float64 {
 
 	if i == j {
 		return 0.0
@@ -56,26 +160,287 @@ func swapDelta(i int, j int, perm []int, dist [][]float64) float64 {
 	np := len(perm)
 	if (i-j-1)%np == 0 {
 		// j immediately before i
-		dd -= dist[perm[i%np]][perm[(i+1)%np]]
-		dd -= dist[perm[(np+j-1)%np]][perm[j%np]] // add np to first index to avoid -1%np
-		dd += dist[perm[(np+j-1)%np]][perm[i%np]]
-		dd += dist[perm[j%np]][perm[(i+1)%np]]
+		dd -= dist.at(perm[i%np], perm[(i+1)%np])
+		dd -= dist.at(perm[(np+j-1)%np], perm[j%np]) // add np to first index to avoid -1%np
+		dd += dist.at(perm[(np+j-1)%np], perm[i%np])
+		dd += dist.at(perm[j%np], perm[(i+1)%np])
+		// the edge between them changes direction (0 if symmetric)
+		dd += dist.at(perm[i%np], perm[j%np]) - dist.at(perm[j%np], perm[i%np])
 	} else if (i-j+1)%np == 0 {
 		// i immediately before j
-		dd -= dist[perm[j%np]][perm[(j+1)%np]]
-		dd -= dist[perm[(np+i-1)%np]][perm[i%np]]
-		dd += dist[perm[(np+i-1)%np]][perm[j%np]]
-		dd += dist[perm[i%np]][perm[(j+1)%np]]
+		dd -= dist.at(perm[j%np], perm[(j+1)%np])
+		dd -= dist.at(perm[(np+i-1)%np], perm[i%np])
+		dd += dist.at(perm[(np+i-1)%np], perm[j%np])
+		dd += dist.at(perm[i%np], perm[(j+1)%np])
+		dd += dist.at(perm[j%np], perm[i%np]) - dist.at(perm[i%np], perm[j%np])
 	} else {
 		// i,j separated mod npoints
-		dd -= dist[perm[(np+i-1)%np]][perm[i%np]]
-		dd -= dist[perm[i%np]][perm[(i+1)%np]]
-		dd -= dist[perm[(np+j-1)%np]][perm[j%np]]
-		dd -= dist[perm[j%np]][perm[(j+1)%np]]
-		dd += dist[perm[(np+i-1)%np]][perm[j%np]]
-		dd += dist[perm[j%np]][perm[(i+1)%np]]
-		dd += dist[perm[(np+j-1)%np]][perm[i%np]]
-		dd += dist[perm[i%np]][perm[(j+1)%np]]
+		dd -= dist.at(perm[(np+i-1)%np], perm[i%np])
+		dd -= dist.at(perm[i%np], perm[(i+1)%np])
+		dd -= dist.at(perm[(np+j-1)%np], perm[j%np])
+		dd -= dist.at(perm[j%np], perm[(j+1)%np])
+		dd += dist.at(perm[(np+i-1)%np], perm[j%np])
+		dd += dist.at(perm[j%np], perm[(i+1)%np])
+		dd += dist.at(perm[(np+j-1)%np], perm[i%np])
+		dd += dist.at(perm[i%np], perm[(j+1)%np])
+	}
+	return dd
+}
+
+/*
+Or-opt move class: lift a segment of 1-3 consecutive cities starting at index i
+and reinsert it, optionally reversed, between the cities at indices j and j+1.
+
+The variant v, 0-5, is drawn with the indices: the segment length is 1 + v mod 3,
+reversed if v >= 3. The shift move class is the same without reversal (v 0-2).
+*/
+func orOptVariant(i int, j int, v int, np int) (int, bool, bool) {
+
+	seglen := 1 + v%3
+	if seglen > np-i {
+		seglen = np - i
+	}
+	// no-op if j falls in the segment or immediately before it
+	if np-seglen < 2 || (j >= i && j < i+seglen) || j == (np+i-1)%np {
+		return seglen, false, false
+	}
+	return seglen, v >= 3, true
+}
+
+func orOpt(i int, j int, v int, perm []int) {
+	orMove(i, j, v, perm, true)
+}
+
+func shift(i int, j int, v int, perm []int) {
+	orMove(i, j, v, perm, false)
+}
+
+func orMove(i int, j int, v int, perm []int, reversible bool) {
+
+	seglen, rev, ok := orOptVariant(i, j, v, len(perm))
+	rev = rev && reversible
+	if !ok {
+		return
+	}
+	var seg [3]int
+	copy(seg[:seglen], perm[i:i+seglen])
+	if rev {
+		reverseSlice(seg[:seglen])
+	}
+	if j > i {
+		// segment moves forward
+		copy(perm[i:], perm[i+seglen:j+1])
+		copy(perm[j-seglen+1:j+1], seg[:seglen])
+	} else {
+		// segment moves back
+		copy(perm[j+1+seglen:i+seglen], perm[j+1:i])
+		copy(perm[j+1:j+1+seglen], seg[:seglen])
 	}
+}
+
+// energy delta for Or-opt
+func orOptDelta(i int, j int, v int, perm []int, dist distOracle) float64 {
+	return orMoveDelta(i, j, v, perm, dist, true)
+}
+
+// energy delta for shift
+func shiftDelta(i int, j int, v int, perm []int, dist distOracle) float64 {
+	return orMoveDelta(i, j, v, perm, dist, false)
+}
+
+func orMoveDelta(i int, j int, v int, perm []int, dist distOracle, reversible bool) float64 {
+
+	np := len(perm)
+	seglen, rev, ok := orOptVariant(i, j, v, np)
+	rev = rev && reversible
+	if !ok {
+		return 0.0
+	}
+	a := perm[(np+i-1)%np]
+	first, last := perm[i], perm[i+seglen-1]
+	b := perm[(i+seglen)%np]
+	c := perm[j]
+	d := perm[(j+1)%np]
+	dd := 0.0
+	// close the gap left by the segment
+	dd -= dist.at(a, first)
+	dd -= dist.at(last, b)
+	dd += dist.at(a, b)
+	// open the gap between c and d
+	if rev {
+		first, last = last, first
+	}
+	dd -= dist.at(c, d)
+	dd += dist.at(c, first)
+	dd += dist.at(last, d)
+	return dd
+}
+
+// sort a tuple of at most 4 indices, reporting whether they are distinct
+func sortIndices(idx []int) ([4]int, bool) {
+
+	var s [4]int
+	n := copy(s[:], idx)
+	for a := 1; a < n; a++ {
+		for b := a; b > 0 && s[b-1] > s[b]; b-- {
+			s[b-1], s[b] = s[b], s[b-1]
+		}
+	}
+	for a := 1; a < n; a++ {
+		if s[a-1] == s[a] {
+			return s, false
+		}
+	}
+	return s, true
+}
+
+/*
+3-opt segment exchange: indices i < j < k cut the tour into
+A = ..perm[i], B = perm[i+1..j], C = perm[j+1..k], D = perm[k+1]..
+and B, C are reconnected by one of 7 cases, drawn as a fourth index:
+
+	0: A B' C D    1: A B C' D    2: A C' B' D    (2-opt)
+	3: A B' C' D   4: A C B D     5: A C' B D    6: A C B' D
+
+(' = reversed). Case 4 is the pure segment exchange preserving direction.
+*/
+func threeOptVariant(idx []int) ([4]int, int, bool) {
+
+	s, ok := sortIndices(idx[:3])
+	return s, idx[3], ok
+}
+
+func threeOpt(idx []int, perm []int) {
+
+	s, c, ok := threeOptVariant(idx)
+	if !ok {
+		return
+	}
+	i, j, k := s[0], s[1], s[2]
+	b := perm[i+1 : j+1]
+	bc := perm[i+1 : k+1]
+	cc := perm[j+1 : k+1]
+	switch c {
+	case 0:
+		reverseSlice(b)
+	case 1:
+		reverseSlice(cc)
+	case 2:
+		reverseSlice(bc)
+	case 3:
+		reverseSlice(b)
+		reverseSlice(cc)
+	case 4:
+		reverseSlice(b)
+		reverseSlice(cc)
+		reverseSlice(bc)
+	case 5:
+		reverseSlice(b)
+		reverseSlice(bc)
+	case 6:
+		reverseSlice(cc)
+		reverseSlice(bc)
+	}
+}
+
+// energy delta for 3-opt
+func threeOptDelta(idx []int, perm []int, dist distOracle) float64 {
+
+	s, c, ok := threeOptVariant(idx)
+	if !ok {
+		return 0.0
+	}
+	np := len(perm)
+	i, j, k := s[0], s[1], s[2]
+	a, b1, bL := perm[i], perm[i+1], perm[j]
+	c1, cL, d := perm[j+1], perm[k], perm[(k+1)%np]
+	dd := 0.0
+	switch c {
+	case 0:
+		dd += dist.at(a, bL) + dist.at(b1, c1)
+		dd -= dist.at(a, b1) + dist.at(bL, c1)
+	case 1:
+		dd += dist.at(bL, cL) + dist.at(c1, d)
+		dd -= dist.at(bL, c1) + dist.at(cL, d)
+	case 2:
+		dd += dist.at(a, cL) + dist.at(b1, d)
+		dd -= dist.at(a, b1) + dist.at(cL, d)
+	default:
+		dd -= dist.at(a, b1) + dist.at(bL, c1) + dist.at(cL, d)
+		switch c {
+		case 3:
+			dd += dist.at(a, bL) + dist.at(b1, cL) + dist.at(c1, d)
+		case 4:
+			dd += dist.at(a, c1) + dist.at(cL, b1) + dist.at(bL, d)
+		case 5:
+			dd += dist.at(a, cL) + dist.at(c1, b1) + dist.at(bL, d)
+		case 6:
+			dd += dist.at(a, c1) + dist.at(cL, bL) + dist.at(b1, d)
+		}
+	}
+	return dd
+}
+
+// exchange move class: 3-opt case 4, A C B D, exchanging the segments B and C
+func exchange(idx []int, perm []int) {
+
+	s, ok := sortIndices(idx)
+	if !ok {
+		return
+	}
+	i, j, k := s[0], s[1], s[2]
+	reverseSlice(perm[i+1 : j+1])
+	reverseSlice(perm[j+1 : k+1])
+	reverseSlice(perm[i+1 : k+1])
+}
+
+// energy delta for exchange
+func exchangeDelta(idx []int, perm []int, dist distOracle) float64 {
+
+	s, ok := sortIndices(idx)
+	if !ok {
+		return 0.0
+	}
+	np := len(perm)
+	i, j, k := s[0], s[1], s[2]
+	a, b1, bL := perm[i], perm[i+1], perm[j]
+	c1, cL, d := perm[j+1], perm[k], perm[(k+1)%np]
+	dd := 0.0
+	dd -= dist.at(a, b1) + dist.at(bL, c1) + dist.at(cL, d)
+	dd += dist.at(a, c1) + dist.at(cL, b1) + dist.at(bL, d)
+	return dd
+}
+
+/*
+Double-bridge (4-opt) kick: indices p0 < p1 < p2 < p3 cut the tour into
+B = perm[p0+1..p1], C = perm[p1+1..p2], D = perm[p2+1..p3] and A (the rest),
+and A B C D is reconnected as A D C B. No segment is reversed.
+*/
+func doubleBridge(idx []int, perm []int) {
+
+	s, ok := sortIndices(idx)
+	if !ok {
+		return
+	}
+	reverseSlice(perm[s[0]+1 : s[1]+1])
+	reverseSlice(perm[s[1]+1 : s[2]+1])
+	reverseSlice(perm[s[2]+1 : s[3]+1])
+	reverseSlice(perm[s[0]+1 : s[3]+1])
+}
+
+// energy delta for double-bridge
+func doubleBridgeDelta(idx []int, perm []int, dist distOracle) float64 {
+
+	s, ok := sortIndices(idx)
+	if !ok {
+		return 0.0
+	}
+	np := len(perm)
+	a, b1, bL := perm[s[0]], perm[s[0]+1], perm[s[1]]
+	c1, cL := perm[s[1]+1], perm[s[2]]
+	d1, dL, e := perm[s[2]+1], perm[s[3]], perm[(s[3]+1)%np]
+	dd := 0.0
+	dd -= dist.at(a, b1) + dist.at(bL, c1) + dist.at(cL, d1) + dist.at(dL, e)
+	dd += dist.at(a, d1) + dist.at(dL, c1) + dist.at(cL, b1) + dist.at(bL, e)
 	return dd
 }
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+/*
+Multiple travelling salesmen (mTSP): m tours from a shared depot, together
+visiting every other city once, minimising the total length or the longest
+tour (min-max).
+
+A state is a single "giant tour" of the cities plus m-1 copies of the depot
+(cities n..n+m-2, with the depot's label and point): each depot or copy starts
+a salesman's tour, which ends at the next. The problem's distance oracle is
+wrapped in an mtspDist that maps the copies to the depot, so every move class
+works unchanged, within a tour or, across a depot, between tours (e.g. reverse
+exchanges the ends of two tours, shift relocates a segment to another tour,
+swap exchanges cities). An empty tour, two depots in a row, costs the longest
+round trip to a single city, so that emptying a tour never pays.
+
+Under the total objective the giant tour's length is the total length, with
+its usual O(1) deltas (and local search and the lower bound apply). Under
+min-max the energy is the longest tour (travelDist), and each move's delta is
+exact by evaluating the state after the move: O(n) per proposal.
+*/
+
+// distances of the giant tour of an mTSP
+type mtspDist struct {
+	distOracle
+	depot    int
+	salesmen int
+	minmax   bool    // objective: longest tour rather than total length
+	penalty  float64 // length of an empty tour
+}
+
+func (d mtspDist) size() int { return d.distOracle.size() + d.salesmen - 1 }
+
+func (d mtspDist) at(i int, j int) float64 {
+	if d.isDepot(i) && d.isDepot(j) {
+		if i == j {
+			return 0.0
+		}
+		return d.penalty
+	}
+	return d.distOracle.at(d.city(i), d.city(j))
+}
+
+// the city of a state element (the depot for its copies)
+func (d mtspDist) city(i int) int {
+	if i >= d.distOracle.size() {
+		return d.depot
+	}
+	return i
+}
+
+func (d mtspDist) isDepot(i int) bool {
+	return i == d.depot || i >= d.distOracle.size()
+}
+
+// the start of salesman s's tour: the depot, then its copies
+func (d mtspDist) depotNode(s int) int {
+	if s == 0 {
+		return d.depot
+	}
+	return d.distOracle.size() + s - 1
+}
+
+// make the problem an mTSP of m salesmen from the city of the given label
+// ("": the first city), with objective "total" or "minmax"
+func (prob *tspProblem) setSalesmen(m int, depot string, objective string) error {
+
+	if objective != "total" && objective != "minmax" {
+		return fmt.Errorf("unknown mTSP objective %q (total or minmax)", objective)
+	}
+	n := prob.dist.size()
+	if m < 1 || m >= n {
+		return fmt.Errorf("nr salesmen must be between 1 and %d", n-1)
+	}
+	if m == 1 {
+		return nil
+	}
+	if err := checkClosed(*prob, "mTSP"); err != nil {
+		return err
+	}
+	d := mtspDist{distOracle: prob.dist, salesmen: m, minmax: objective == "minmax"}
+	var err error
+	if d.depot, err = prob.cityIndex(depot); err != nil {
+		return err
+	}
+	if d.depot < 0 {
+		d.depot = 0
+	}
+	for j := 0; j < n; j++ {
+		d.penalty = math.Max(d.penalty, prob.dist.at(d.depot, j)+prob.dist.at(j, d.depot))
+	}
+
+	// the copies of the depot
+	for s := 1; s < m; s++ {
+		prob.labels = append(prob.labels, prob.labels[d.depot])
+		if prob.points != nil {
+			prob.points = append(prob.points, prob.points[d.depot])
+		}
+	}
+	prob.dist = d
+	return nil
+}
+
+// an error if the problem is a min-max mTSP, for methods on the total length
+func checkTotal(prob tspProblem, method string) error {
+
+	if d, ok := prob.dist.(mtspDist); ok && d.minmax {
+		return fmt.Errorf("%s needs the total length objective", method)
+	}
+	return nil
+}
+
+// position of the first depot in a state
+func (d mtspDist) firstDepot(state []int) int {
+
+	for p, c := range state {
+		if d.isDepot(c) {
+			return p
+		}
+	}
+	return -1
+}
+
+// the salesmen's tours in a state, each as the cities after the depot
+func (d mtspDist) tours(state []int) [][]int {
+
+	np := len(state)
+	first := d.firstDepot(state)
+	var tours [][]int
+	for k := 0; k < np; k++ {
+		c := state[(first+k)%np]
+		if d.isDepot(c) {
+			tours = append(tours, []int{})
+		} else {
+			tours[len(tours)-1] = append(tours[len(tours)-1], c)
+		}
+	}
+	return tours
+}
+
+// the length of each salesman's tour in a state, in the order of tours()
+func (d mtspDist) tourLengths(state []int) []float64 {
+
+	np := len(state)
+	first := d.firstDepot(state)
+	lengths := make([]float64, 0, d.salesmen)
+	for k := 0; k < np; k++ {
+		c := state[(first+k)%np]
+		if d.isDepot(c) {
+			lengths = append(lengths, 0.0)
+		}
+		lengths[len(lengths)-1] += d.at(c, state[(first+k+1)%np])
+	}
+	return lengths
+}
+
+// the longest tour in a state
+func (d mtspDist) longest(state []int) float64 {
+
+	np := len(state)
+	first := d.firstDepot(state)
+	max, length := 0.0, 0.0
+	for k := 0; k < np; k++ {
+		c := state[(first+k)%np]
+		if d.isDepot(c) {
+			max = math.Max(max, length)
+			length = 0.0
+		}
+		length += d.at(c, state[(first+k+1)%np])
+	}
+	return math.Max(max, length)
+}
+
+// spread the depots evenly along a state, if it has an empty tour
+func (d mtspDist) fillTours(state []int) {
+
+	empty := false
+	for _, t := range d.tours(state) {
+		empty = empty || len(t) == 0
+	}
+	if !empty {
+		return
+	}
+	cities := make([]int, 0, len(state))
+	for _, t := range d.tours(state) {
+		cities = append(cities, t...)
+	}
+	n, k := len(cities), 0
+	for s := 0; s < d.salesmen; s++ {
+		state[k] = d.depotNode(s)
+		k++
+		for _, c := range cities[s*n/d.salesmen : (s+1)*n/d.salesmen] {
+			state[k] = c
+			k++
+		}
+	}
+}
+
+// move classes for an mTSP (unchanged unless the objective is min-max)
+func mtspMoves(mix moveMix, dist distOracle) moveMix {
+
+	d, ok := dist.(mtspDist)
+	if !ok || !d.minmax {
+		return mix
+	}
+	// states after a move, shared by the walkers' go routines
+	scratch := &sync.Pool{New: func() any { return new([]int) }}
+	classes := make([]moveClass, len(mix.classes))
+	for k, mc := range mix.classes {
+		move := mc.move
+		mc.delta = func(idx []int, perm []int, dist distOracle) float64 {
+			buf := scratch.Get().(*[]int)
+			after := append((*buf)[:0], perm...)
+			move(idx, after)
+			delta := travelDist(after, dist) - travelDist(perm, dist)
+			*buf = after
+			scratch.Put(buf)
+			return delta
+		}
+		classes[k] = mc
+	}
+	mix.classes = classes
+	return mix
+}
+
+// show each salesman's tour of a state, or the route if a single one
+func printTours(state []int, prob tspProblem) {
+
+	d, ok := prob.dist.(mtspDist)
+	if !ok {
+		printRoute(state, prob.labels, isOpen(prob.dist))
+		return
+	}
+	lengths := d.tourLengths(state)
+	total := 0.0
+	for s, t := range d.tours(state) {
+		fmt.Printf("Salesman %d (distance %v): ", s+1, lengths[s])
+		printRoute(append([]int{d.depot}, t...), prob.labels, false)
+		total += lengths[s]
+	}
+	fmt.Printf("Total distance %v, longest tour %v\n", total, d.longest(state))
+}
+
+// a state as a route of cities, through the depot between the tours of an mTSP
+func cityRoute(state []int, dist distOracle) []int {
+
+	d, ok := dist.(mtspDist)
+	if !ok {
+		return state
+	}
+	var route []int
+	for _, t := range d.tours(state) {
+		route = append(route, d.depot)
+		route = append(route, t...)
+	}
+	return route
+}
+
+// output the salesmen's tours of a state as TSPLIB tours of the cities, each
+// from the depot (one tour, if a single salesman)
+func writeSalesmenTours(state []int, dist distOracle, fileName string) {
+
+	d, ok := dist.(mtspDist)
+	if !ok {
+		writeTour(state, fileName)
+		return
+	}
+	var tours [][]int
+	for _, t := range d.tours(state) {
+		tours = append(tours, append([]int{d.depot}, t...))
+	}
+	writeTours(tours, d.distOracle.size(), fileName)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"container/heap"
+	"math/rand"
+	"sort"
+)
+
+/*
+Neighbour lists: the k nearest cities to each city, found with a k-d tree over
+the problem's points when its metric orders cities as the Euclidean distance
+does, else by brute force from the distance oracle in O(n^2 log k) (e.g.
+explicit TSPLIB matrices, or haversine distances on lat/long).
+
+Neighbour-restricted proposals choose i uniformly and then j so that the new edge
+made by reversing between i and j joins city state[i] to one of its near neighbours.
+*/
+
+// k-d tree node: a point index splitting its subtree on one axis
+type kdNode struct {
+	point       int
+	axis        int
+	left, right *kdNode
+}
+
+func buildKdTree(points [][2]float64, idx []int, depth int) *kdNode {
+
+	if len(idx) == 0 {
+		return nil
+	}
+	axis := depth % 2
+	sort.Slice(idx, func(a, b int) bool { return points[idx[a]][axis] < points[idx[b]][axis] })
+	m := len(idx) / 2
+	return &kdNode{
+		point: idx[m],
+		axis:  axis,
+		left:  buildKdTree(points, idx[:m], depth+1),
+		right: buildKdTree(points, idx[m+1:], depth+1)}
+}
+
+// metrics ordering cities as the Euclidean distance does, for the k-d tree
+var euclideanOrder = map[string]bool{"euclid": true, "euc2d": true, "ceil2d": true, "att": true}
+
+// bounded max-heap of candidate neighbours by distance (squared, in the k-d tree)
+type candidate struct {
+	point int
+	d2    float64
+}
+type candidateHeap []candidate
+
+func (h candidateHeap) Len() int            { return len(h) }
+func (h candidateHeap) Less(a, b int) bool  { return h[a].d2 > h[b].d2 }
+func (h candidateHeap) Swap(a, b int)       { h[a], h[b] = h[b], h[a] }
+func (h *candidateHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *candidateHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// keep a candidate if among the k nearest so far
+func (h *candidateHeap) offer(c candidate, k int) {
+	if h.Len() < k {
+		heap.Push(h, c)
+	} else if c.d2 < (*h)[0].d2 {
+		(*h)[0] = c
+		heap.Fix(h, 0)
+	}
+}
+
+// k nearest points to points[q], excluding q itself
+func (t *kdNode) nearest(points [][2]float64, q int, k int, h *candidateHeap) {
+
+	if t == nil {
+		return
+	}
+	p := points[t.point]
+	dx, dy := p[0]-points[q][0], p[1]-points[q][1]
+	if t.point != q {
+		h.offer(candidate{t.point, dx*dx + dy*dy}, k)
+	}
+	diff := points[q][t.axis] - p[t.axis]
+	near, far := t.left, t.right
+	if diff > 0 {
+		near, far = t.right, t.left
+	}
+	near.nearest(points, q, k, h)
+	if h.Len() < k || diff*diff < (*h)[0].d2 {
+		far.nearest(points, q, k, h)
+	}
+}
+
+// k nearest neighbours of each city, nearest first
+func neighbourLists(prob tspProblem, k int) [][]int {
+
+	npoints := prob.dist.size()
+	if k > npoints-1 {
+		k = npoints - 1
+	}
+	nbrs := make([][]int, npoints)
+
+	// the k-d tree, unless the distances (e.g. between the depot copies of an
+	// mTSP) are not the Euclidean ones
+	var tree *kdNode
+	if _, mtsp := prob.dist.(mtspDist); prob.points != nil && euclideanOrder[prob.metric] && !mtsp {
+		idx := make([]int, npoints)
+		for i := range idx {
+			idx[i] = i
+		}
+		tree = buildKdTree(prob.points, idx, 0)
+	}
+	for i := 0; i < npoints; i++ {
+		h := make(candidateHeap, 0, k)
+		if tree != nil {
+			tree.nearest(prob.points, i, k, &h)
+		} else {
+			// brute force on the distance oracle
+			for j := 0; j < npoints; j++ {
+				if j != i {
+					h.offer(candidate{j, prob.dist.at(i, j)}, k)
+				}
+			}
+		}
+		// order by the problem's metric
+		nbrs[i] = make([]int, h.Len())
+		for a, c := range h {
+			nbrs[i][a] = c.point
+		}
+		sort.Slice(nbrs[i], func(a, b int) bool { return prob.dist.at(i, nbrs[i][a]) < prob.dist.at(i, nbrs[i][b]) })
+	}
+	return nbrs
+}
+
+/*
+Proposal state of a walker: with neighbour lists, track the position of each city
+in the state so that a neighbour's index can be found in constant time.
+*/
+type proposer struct {
+	state      []int
+	neighbours [][]int
+	pos        []int
+}
+
+func (w tspWalker) newProposer() *proposer {
+
+	pr := proposer{state: w.state, neighbours: w.neighbours}
+	if w.neighbours != nil {
+		pr.pos = make([]int, len(w.state))
+		for p, c := range w.state {
+			pr.pos[c] = p
+		}
+	}
+	return &pr
+}
+
+// draw the indices of a proposal, the last its variant if the move class has
+// variants
+func (pr *proposer) propose(idx []int, variants int) {
+
+	npoints := len(pr.state)
+	if variants > 0 {
+		idx[len(idx)-1] = rand.Intn(variants)
+		idx = idx[:len(idx)-1]
+	}
+	for k := range idx {
+		idx[k] = rand.Intn(npoints)
+	}
+	if pr.neighbours == nil {
+		return
+	}
+	i := idx[0]
+	nbrs := pr.neighbours[pr.state[i]]
+	q := pr.pos[nbrs[rand.Intn(len(nbrs))]]
+	if q > i {
+		idx[1] = q - 1
+	} else {
+		idx[1] = q + 1
+	}
+}
+
+// refresh positions after a move at indices idx: move classes only permute
+// positions between the smallest and largest index (plus an Or-opt segment)
+func (pr *proposer) update(idx []int, variants int) {
+
+	if pr.neighbours == nil {
+		return
+	}
+	if variants > 0 {
+		idx = idx[:len(idx)-1]
+	}
+	lo, hi := idx[0], idx[0]
+	for _, p := range idx[1:] {
+		if p < lo {
+			lo = p
+		}
+		if p > hi {
+			hi = p
+		}
+	}
+	hi += 2
+	if hi >= len(pr.state) {
+		hi = len(pr.state) - 1
+	}
+	for p := lo; p <= hi; p++ {
+		pr.pos[pr.state[p]] = p
+	}
+}
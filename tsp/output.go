@@ -4,15 +4,23 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
 )
 
 // show a given route
-func printRoute(perm []int, labels []string) {
+func printRoute(perm []int, labels []string, open bool) {
 
-	for _, v := range perm {
-		fmt.Printf("%v --> ", labels[v])
+	for k, v := range perm {
+		if k > 0 {
+			fmt.Printf(" --> ")
+		}
+		fmt.Printf("%v", labels[v])
 	}
-	fmt.Printf("%v\n", labels[perm[0]])
+	if !open {
+		// back to the start
+		fmt.Printf(" --> %v", labels[perm[0]])
+	}
+	fmt.Printf("\n")
 }
 
 // output permutation to file
@@ -27,3 +35,34 @@ func writePerm(perm []int, fileName string) {
 	}
 	wrt.Flush()
 }
+
+// output permutation to file as a TSPLIB tour (1-up node numbers)
+func writeTour(perm []int, fileName string) {
+	writeTours([][]int{perm}, len(perm), fileName)
+}
+
+// output tours on dim cities to file as TSPLIB tours, each terminated by -1
+func writeTours(tours [][]int, dim int, fileName string) {
+
+	file, _ := os.Create(fileName)
+	defer file.Close()
+	wrt := bufio.NewWriter(file)
+	fmt.Fprintf(wrt, "NAME : %s\n", filepath.Base(fileName))
+	fmt.Fprintf(wrt, "TYPE : TOUR\n")
+	fmt.Fprintf(wrt, "DIMENSION : %d\n", dim)
+	fmt.Fprintf(wrt, "TOUR_SECTION\n")
+	for _, tour := range tours {
+		for _, j := range tour {
+			fmt.Fprintf(wrt, "%d\n", j+1)
+		}
+		fmt.Fprintf(wrt, "-1\n")
+	}
+	fmt.Fprintf(wrt, "EOF\n")
+	wrt.Flush()
+}
+
+// report best distance against a reference (known optimum, lower bound)
+func reportGap(best_e float64, reference string, ref_e float64) {
+
+	fmt.Printf("Best %v / %s %v / gap %.3f%%\n", best_e, reference, ref_e, 100.0*(best_e-ref_e)/ref_e)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+)
+
+/*
+Open paths: a Hamiltonian path state[0] -> ... -> state[np-1], without the edge
+closing the tour, optionally from a fixed start city and/or to a fixed end city.
+
+The problem's distance oracle is wrapped in an openDist, so that travelDist
+leaves out the closing edge. Each move class is wrapped to know the cities at
+the two ends of the permutation after a move (moveEnds): its delta then drops
+the change of the closing edge, and a move that would take a fixed city away
+from its end is a no-op (delta 0). Walkers start with the fixed cities at the
+ends (startTour).
+
+Local search, the lower bound and the exact solvers assume closed tours.
+*/
+
+// distances of an open path, with fixed end cities (-1: free)
+type openDist struct {
+	distOracle
+	start, end int
+}
+
+func isOpen(dist distOracle) bool {
+	_, ok := dist.(openDist)
+	return ok
+}
+
+// make the problem an open path, from and to the cities of the given labels
+// ("": free)
+func (prob *tspProblem) setOpen(start string, end string) error {
+
+	if isOpen(prob.dist) {
+		return nil
+	}
+	d := openDist{distOracle: prob.dist}
+	var err error
+	if d.start, err = prob.cityIndex(start); err != nil {
+		return err
+	}
+	if d.end, err = prob.cityIndex(end); err != nil {
+		return err
+	}
+	if d.start >= 0 && d.start == d.end {
+		return fmt.Errorf("path start and end are the same city %s", start)
+	}
+	prob.dist = d
+	return nil
+}
+
+// an error if the problem is an open path, for methods assuming closed tours
+func checkClosed(prob tspProblem, method string) error {
+
+	if isOpen(prob.dist) {
+		return fmt.Errorf("%s needs a closed tour", method)
+	}
+	return nil
+}
+
+// bring the fixed cities to the ends of a state
+func (d openDist) fixEnds(state []int) {
+
+	np := len(state)
+	at := func(c int) int {
+		for p, x := range state {
+			if x == c {
+				return p
+			}
+		}
+		return -1
+	}
+	rotate := func(k int) {
+		reverseSlice(state[:k])
+		reverseSlice(state[k:])
+		reverseSlice(state)
+	}
+	if d.start >= 0 {
+		rotate(at(d.start))
+	}
+	if d.end >= 0 {
+		q := at(d.end)
+		if d.start >= 0 {
+			state[q], state[np-1] = state[np-1], state[q]
+		} else {
+			rotate((q + 1) % np)
+		}
+	}
+}
+
+// move classes for an open path problem (unchanged if the tour is closed)
+func openMoves(mix moveMix, dist distOracle) (moveMix, error) {
+
+	d, ok := dist.(openDist)
+	if !ok {
+		return mix, nil
+	}
+	classes := make([]moveClass, len(mix.classes))
+	for k, mc := range mix.classes {
+		ends := moveEnds(mc.name)
+		if ends == nil {
+			return mix, fmt.Errorf("move class %s not supported on open paths", mc.name)
+		}
+		classes[k] = openMove(mc, d, ends)
+	}
+	mix.classes = classes
+	return mix, nil
+}
+
+func openMove(mc moveClass, d openDist, ends func([]int, []int) (int, int)) moveClass {
+
+	move, delta := mc.move, mc.delta
+	allowed := func(idx []int, perm []int) (int, int, bool) {
+		first, last := ends(idx, perm)
+		return first, last, (d.start < 0 || first == d.start) && (d.end < 0 || last == d.end)
+	}
+	mc.move = func(idx []int, perm []int) {
+		if _, _, ok := allowed(idx, perm); ok {
+			move(idx, perm)
+		}
+	}
+	mc.delta = func(idx []int, perm []int, dist distOracle) float64 {
+		first, last, ok := allowed(idx, perm)
+		if !ok {
+			return 0.0
+		}
+		// the tour delta, less the change of the closing edge
+		np := len(perm)
+		return delta(idx, perm, dist) - dist.at(last, first) + dist.at(perm[np-1], perm[0])
+	}
+	return mc
+}
+
+// the cities at the ends of the permutation after a move, by move class
+func moveEnds(name string) func([]int, []int) (int, int) {
+
+	switch name {
+	case "reverse":
+		return pairEnds(reverseEnds)
+	case "swap":
+		return pairEnds(swapEnds)
+	case "oropt":
+		return func(idx []int, perm []int) (int, int) { return orMoveEnds(idx[0], idx[1], idx[2], perm, true) }
+	case "shift":
+		return func(idx []int, perm []int) (int, int) { return orMoveEnds(idx[0], idx[1], idx[2], perm, false) }
+	case "3opt":
+		return threeOptEnds
+	case "exchange":
+		return exchangeEnds
+	case "bridge":
+		return doubleBridgeEnds
+	}
+	return nil
+}
+
+func pairEnds(ends func(int, int, []int) (int, int)) func([]int, []int) (int, int) {
+	return func(idx []int, perm []int) (int, int) {
+		return ends(idx[0], idx[1], perm)
+	}
+}
+
+func reverseEnds(i int, j int, perm []int) (int, int) {
+	np := len(perm)
+	if i > j {
+		i, j = j, i
+	}
+	first, last := perm[0], perm[np-1]
+	if i == j {
+		return first, last
+	}
+	if i == 0 {
+		first = perm[j]
+	}
+	if j == np-1 {
+		last = perm[i]
+	}
+	return first, last
+}
+
+func swapEnds(i int, j int, perm []int) (int, int) {
+	np := len(perm)
+	first, last := perm[0], perm[np-1]
+	switch {
+	case i == j:
+	case i == 0:
+		first = perm[j]
+	case j == 0:
+		first = perm[i]
+	}
+	switch {
+	case i == j:
+	case i == np-1:
+		last = perm[j]
+	case j == np-1:
+		last = perm[i]
+	}
+	return first, last
+}
+
+func orMoveEnds(i int, j int, v int, perm []int, reversible bool) (int, int) {
+	np := len(perm)
+	first, last := perm[0], perm[np-1]
+	seglen, rev, ok := orOptVariant(i, j, v, np)
+	if !ok {
+		return first, last
+	}
+	if j > i {
+		// segment moves forward, to the end if j = np-1
+		if i == 0 {
+			first = perm[seglen]
+		}
+		if j == np-1 {
+			last = perm[i+seglen-1]
+			if rev && reversible {
+				last = perm[i]
+			}
+		}
+	} else if i+seglen == np {
+		// segment moves back from the end
+		last = perm[i-1]
+	}
+	return first, last
+}
+
+// the first city is never moved by 3opt, exchange or bridge; the last is if
+// the last cut is at np-1
+func threeOptEnds(idx []int, perm []int) (int, int) {
+	np := len(perm)
+	s, c, ok := threeOptVariant(idx)
+	if !ok || s[2] != np-1 {
+		return perm[0], perm[np-1]
+	}
+	i, j := s[0], s[1]
+	switch c {
+	case 1, 3:
+		return perm[0], perm[j+1]
+	case 2, 6:
+		return perm[0], perm[i+1]
+	case 4, 5:
+		return perm[0], perm[j]
+	}
+	return perm[0], perm[np-1]
+}
+
+func exchangeEnds(idx []int, perm []int) (int, int) {
+	np := len(perm)
+	s, ok := sortIndices(idx)
+	if !ok || s[2] != np-1 {
+		return perm[0], perm[np-1]
+	}
+	return perm[0], perm[s[1]]
+}
+
+func doubleBridgeEnds(idx []int, perm []int) (int, int) {
+	np := len(perm)
+	s, ok := sortIndices(idx)
+	if !ok || s[3] != np-1 {
+		return perm[0], perm[np-1]
+	}
+	return perm[0], perm[s[1]]
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/*
+Population annealing (Hukushima & Iba 2003, Machta 2010):
+
+- a population of replicas (one per walker) is cooled in lockstep by the
+  walkers' schedule
+- at each temperature step beta -> beta' the replicas are reweighted by the
+  Boltzmann factors exp(-(beta'-beta) E) and resampled (systematic resampling,
+  population size fixed)
+- then each replica runs one period of Metropolis moves at the new temperature,
+  in parallel (go routines)
+- the random initial tours are an equilibrium sample at beta = 0, where
+  ln Z = ln((n-1)!/2) for tours (lnStates, other counts for asymmetric
+  distances and open paths), so the free energy estimate
+      beta' F' = beta F - ln Q,    Q = mean of the Boltzmann factors
+  is absolute
+- diversity: effective sample size of the weights, and the nr of surviving
+  families (replicas descended from distinct initial tours)
+- same countdown stopping criterion as search()
+*/
+
+// log of the nr of distinct tours of the problem: (n-1)!/2, or (n-1)! if
+// asymmetric; for open paths n!/2 (n! if asymmetric) with free ends, (n-1)!
+// with one fixed end, (n-2)! with both
+func lnStates(prob tspProblem) float64 {
+
+	n := prob.dist.size()
+	lnFactorial := func(k int) float64 {
+		lg, _ := math.Lgamma(float64(k + 1))
+		return lg
+	}
+	d, open := prob.dist.(openDist)
+	switch {
+	case !open && prob.asymmetric:
+		return lnFactorial(n - 1)
+	case !open:
+		return lnFactorial(n-1) - math.Ln2
+	case d.start >= 0 && d.end >= 0:
+		return lnFactorial(n - 2)
+	case d.start >= 0 || d.end >= 0:
+		return lnFactorial(n - 1)
+	case prob.asymmetric:
+		return lnFactorial(n)
+	}
+	return lnFactorial(n) - math.Ln2
+}
+
+// systematic resampling by Boltzmann factors exp(-dbeta E), copying states of
+// replicas and their families: returns ln Q and the effective sample size
+func resample(pop []*replica, family []int, dbeta float64) (float64, float64) {
+
+	nr := len(pop)
+	min_e := pop[0].energy
+	for _, rp := range pop {
+		min_e = math.Min(min_e, rp.energy)
+	}
+	weights := make([]float64, nr)
+	sum, sum_sq := 0.0, 0.0
+	for i, rp := range pop {
+		weights[i] = math.Exp(-dbeta * (rp.energy - min_e))
+		sum += weights[i]
+		sum_sq += weights[i] * weights[i]
+	}
+	lnQ := math.Log(sum/float64(nr)) - dbeta*min_e
+	ess := sum * sum / sum_sq
+
+	// nr of copies of each replica
+	counts := make([]int, nr)
+	u := rand.Float64()
+	cum := 0.0
+	for i, wt := range weights {
+		cum += wt * float64(nr) / sum
+		for u < cum && u < float64(nr) {
+			counts[i]++
+			u++
+		}
+	}
+
+	// overwrite replicas with no copies by the extra copies of others
+	var free []int
+	for i, c := range counts {
+		if c == 0 {
+			free = append(free, i)
+		}
+	}
+	for i, c := range counts {
+		for ; c > 1 && len(free) > 0; c-- {
+			f := free[0]
+			free = free[1:]
+			copy(pop[f].w.state, pop[i].w.state)
+			pop[f].energy = pop[i].energy
+			pop[f].prop = pop[f].w.newProposer()
+			family[f] = family[i]
+		}
+	}
+	return lnQ, ess
+}
+
+func populationAnnealing(walkers []tspWalker, results chan<- packet) {
+
+	par := walkers[0].param
+	verbose := walkers[0].verbose
+	npoints := len(walkers[0].state)
+	nr := len(walkers)
+	sched, _ := walkerRules(par, 0.0)
+
+	pop := make([]*replica, nr)
+	family := make([]int, nr)
+	for i := range pop {
+		pop[i] = walkers[i].newReplica()
+		family[i] = i
+	}
+	best_s := make([]int, npoints)
+	best_e := pop[0].energy
+	copy(best_s, pop[0].w.state)
+	lastBest := 2 * best_e
+	result_ct := 0
+
+	// free energy at beta = 0
+	beta := 0.0
+	betaF := 0.0
+	if npoints > 2 {
+		betaF = -lnStates(walkers[0].problem)
+	}
+	temperature := par.temperature
+	var ess float64
+
+	start := time.Now()
+	for step := 1; step <= par.nperiods; step++ {
+
+		// reweight and resample at the new temperature
+		lnQ, e := resample(pop, family, 1/temperature-beta)
+		betaF -= lnQ
+		beta = 1 / temperature
+		ess = e
+
+		// equilibrate replicas
+		acceptance := make([]float64, nr)
+		var wg sync.WaitGroup
+		for i := range pop {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, acceptance[i] = pop[i].run(temperature)
+			}(i)
+		}
+		wg.Wait()
+
+		// population statistics
+		var stats energyStats
+		st_acc := 0.0
+		for i, rp := range pop {
+			stats.add(rp.energy)
+			st_acc += acceptance[i]
+			if rp.best_e < best_e {
+				best_e = rp.best_e
+				copy(best_s, rp.best_s)
+			}
+			rp.mix.endPeriod()
+		}
+		st := stats.period(step, 0, best_e)
+		st.acceptance = st_acc / float64(nr)
+
+		if verbose {
+			fmt.Printf("%4d: temperature %v, acceptance %v mean dist %v best dist %v free energy %v ess %.1f families %d\n",
+				step, temperature, st.acceptance, st.mean_e, best_e, betaF/beta, ess, nrFamilies(family))
+		}
+
+		// check countdown
+		if best_e == lastBest {
+			result_ct++
+		} else {
+			lastBest = best_e
+			result_ct = 0
+		}
+		if result_ct >= par.countdown {
+			break
+		}
+		temperature = sched.next(temperature, st)
+	}
+	runtime := time.Since(start)
+	fmt.Printf("Population annealing: found distance %v in time %v\n", best_e, runtime)
+	fmt.Printf("  temperature %v free energy %v, ess %.1f, %d/%d families\n",
+		1/beta, betaF/beta, ess, nrFamilies(family), nr)
+
+	// send the best of each replica (the overall best is among them)
+	for _, rp := range pop {
+		var res packet
+		res.id = rp.w.id
+		res.best_e = rp.best_e
+		res.best_s = make([]int, npoints)
+		copy(res.best_s, rp.best_s)
+		results <- res
+	}
+}
+
+// nr of distinct families in the population
+func nrFamilies(family []int) int {
+	seen := make(map[int]bool)
+	for _, f := range family {
+		seen[f] = true
+	}
+	return len(seen)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+/*
+Cooling schedules: at the end of each period at fixed temperature the walker
+passes the period's statistics to its schedule, which returns the next temperature.
+
+To add a schedule, implement next() and add a case to newSchedule.
+*/
+type schedule interface {
+	next(temperature float64, st periodStats) float64
+}
+
+// statistics of a period at fixed temperature
+type periodStats struct {
+	period     int     // nr of periods completed (1-up)
+	acceptance float64 // acceptance rate
+	mean_e     float64 // mean energy
+	var_e      float64 // variance of energy
+	best_e     float64 // best energy so far
+}
+
+// a walker's schedule and acceptance rule, from parameters checked by the
+// caller: on an error (reported) the walker falls back to constant-rate cooling
+// and the Metropolis rule rather than fail mid-run
+func walkerRules(par annealParam, e0 float64) (schedule, acceptor) {
+
+	sched, err := newSchedule(par)
+	if err != nil {
+		fmt.Printf("%v: constant-rate cooling instead\n", err)
+		sched = geometric{cooling: par.cooling}
+	}
+	acc, err := newAcceptor(par, e0)
+	if err != nil {
+		fmt.Printf("%v: Metropolis acceptance instead\n", err)
+		acc = metropolis{}
+	}
+	return sched, acc
+}
+
+// schedule by name, with parameters from annealParam
+func newSchedule(par annealParam) (schedule, error) {
+
+	switch par.schedule {
+	case "", "std":
+		return geometric{cooling: par.cooling}, nil
+	case "sigmage":
+		return &sigmage{cooling: par.cooling, wait: 2}, nil
+	case "linear":
+		if par.nperiods <= 0 || par.tempFinal <= 0 || par.tempFinal >= par.temperature {
+			return nil, fmt.Errorf("linear schedule needs nr periods and final temperature below initial")
+		}
+		step := (par.temperature - par.tempFinal) / float64(par.nperiods)
+		return linear{step: step, tempFinal: par.tempFinal}, nil
+	case "log":
+		return logarithmic{c: par.temperature * math.Ln2}, nil
+	case "lundy":
+		if par.beta <= 0 {
+			return nil, fmt.Errorf("Lundy-Mees schedule needs beta > 0")
+		}
+		return lundyMees{beta: par.beta}, nil
+	case "exp":
+		alpha := par.alpha
+		if alpha <= 0 {
+			// reach the final temperature at the end of the planned periods
+			if par.nperiods <= 0 || par.tempFinal <= 0 || par.tempFinal >= par.temperature {
+				return nil, fmt.Errorf("exp schedule needs alpha > 0, or nr periods and final temperature")
+			}
+			alpha = math.Log(par.temperature/par.tempFinal) / float64(par.nperiods)
+		}
+		return expTime{t0: par.temperature, alpha: alpha}, nil
+	case "huang":
+		if par.lambda <= 0 {
+			return nil, fmt.Errorf("Huang schedule needs lambda > 0")
+		}
+		return huang{lambda: par.lambda, cooling: par.cooling}, nil
+	case "target":
+		if par.nperiods <= 0 || par.acc0 <= 0 || par.acc1 <= 0 || par.acc0 >= 1 || par.acc1 >= 1 || par.gain <= 0 {
+			return nil, fmt.Errorf("target schedule needs nr periods, acceptances in (0,1) and gain > 0")
+		}
+		return accTarget{acc0: par.acc0, acc1: par.acc1, nperiods: par.nperiods, gain: par.gain}, nil
+	}
+	return nil, fmt.Errorf("unknown cooling schedule %q", par.schedule)
+}
+
+// accumulate energies over a period
+type energyStats struct {
+	n      int
+	sum    float64
+	sum_sq float64
+}
+
+func (es *energyStats) add(e float64) {
+	es.n++
+	es.sum += e
+	es.sum_sq += e * e
+}
+
+// period statistics, and reset
+func (es *energyStats) period(period int, accepted int, best_e float64) periodStats {
+
+	st := periodStats{period: period, best_e: best_e}
+	if es.n > 0 {
+		st.acceptance = float64(accepted) / float64(es.n)
+		st.mean_e = es.sum / float64(es.n)
+		st.var_e = es.sum_sq/float64(es.n) - st.mean_e*st.mean_e
+	}
+	*es = energyStats{}
+	return st
+}
+
+// "std": constant cooling rate
+type geometric struct {
+	cooling float64
+}
+
+func (s geometric) next(temperature float64, st periodStats) float64 {
+	return temperature * s.cooling
+}
+
+// "sigmage": cool only once the mean energy has settled to within sqrt(2) sd
+// of the previous period's for a number of consecutive periods
+type sigmage struct {
+	cooling       float64
+	wait          int // waiting time to cool
+	bin_ct        int
+	previous_mean float64
+	previous_sd2  float64
+}
+
+func (s *sigmage) next(temperature float64, st periodStats) float64 {
+
+	if (st.mean_e-s.previous_mean)*(st.mean_e-s.previous_mean) < 2*s.previous_sd2 {
+		s.bin_ct++
+	} else {
+		s.bin_ct = 0
+	}
+	if s.bin_ct >= s.wait {
+		temperature *= s.cooling
+	}
+	s.previous_mean = st.mean_e
+	s.previous_sd2 = st.var_e
+	return temperature
+}
+
+// "linear": constant decrement, reaching tempFinal after the planned periods
+type linear struct {
+	step      float64
+	tempFinal float64
+}
+
+func (s linear) next(temperature float64, st periodStats) float64 {
+	return math.Max(temperature-s.step, s.tempFinal)
+}
+
+// "log": Geman-Geman T_k = c / log(k+2), with T_0 = c / log 2
+type logarithmic struct {
+	c float64
+}
+
+func (s logarithmic) next(temperature float64, st periodStats) float64 {
+	return s.c / math.Log(float64(st.period)+2)
+}
+
+// "lundy": Lundy-Mees T' = T / (1 + beta T)
+type lundyMees struct {
+	beta float64
+}
+
+func (s lundyMees) next(temperature float64, st periodStats) float64 {
+	return temperature / (1 + s.beta*temperature)
+}
+
+// "exp": exponential in time T_k = T_0 exp(-alpha k)
+type expTime struct {
+	t0    float64
+	alpha float64
+}
+
+func (s expTime) next(temperature float64, st periodStats) float64 {
+	return s.t0 * math.Exp(-s.alpha*float64(st.period))
+}
+
+// "huang": Huang, Romeo & Sangiovanni-Vincentelli (1986) adaptive schedule
+// T' = T exp(-lambda T / sigma), sigma the energy standard deviation over the
+// period, with T'/T at least 1/2 (and geometric cooling if sigma vanishes)
+type huang struct {
+	lambda  float64
+	cooling float64
+}
+
+func (s huang) next(temperature float64, st periodStats) float64 {
+	if st.var_e <= 0 {
+		return temperature * s.cooling
+	}
+	factor := math.Exp(-s.lambda * temperature / math.Sqrt(st.var_e))
+	return temperature * math.Max(factor, 0.5)
+}
+
+// "target": feedback control of the temperature so that the measured acceptance
+// follows the target curve acc0 (acc1/acc0)^(k/nperiods), exponential in the period k.
+// T' = T (target/measured)^gain, the factor limited to [1/2, 2] per period.
+type accTarget struct {
+	acc0, acc1 float64
+	nperiods   int
+	gain       float64
+}
+
+func (s accTarget) target(period int) float64 {
+	return s.acc0 * math.Pow(s.acc1/s.acc0, math.Min(1.0, float64(period)/float64(s.nperiods)))
+}
+
+func (s accTarget) next(temperature float64, st periodStats) float64 {
+	measured := math.Max(st.acceptance, 1e-6)
+	factor := math.Pow(s.target(st.period)/measured, s.gain)
+	return temperature * math.Min(math.Max(factor, 0.5), 2.0)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+Tabu search - a deterministic baseline on the reverse and swap move classes.
+
+- each iteration makes the best admissible move of the neighbourhood, even if uphill:
+  either the full neighbourhood (all index pairs, for each move class) or a
+  sample of candidates drawn by the walker's proposer (uniform or neighbour lists)
+- attribute-based tabu list: edges removed by a move may not be added back for
+  tenure iterations
+- aspiration: a tabu move is admissible if it improves on the best energy
+- stops after maxIter iterations, or countdown iterations without improvement
+- run parallel walkers as go routines, reporting as search()
+*/
+
+// an undirected edge between cities
+type edge [2]int
+
+func newEdge(a int, b int) edge {
+	if a > b {
+		a, b = b, a
+	}
+	return edge{a, b}
+}
+
+// edges removed and added by a reverse or swap move
+func moveEdges(name string, i int, j int, perm []int) ([]edge, []edge) {
+
+	np := len(perm)
+	if i > j {
+		i, j = j, i
+	}
+	if i == j || np < 4 {
+		return nil, nil
+	}
+	at := func(k int) int { return perm[(k+np)%np] }
+	switch name {
+	case "reverse":
+		if i == 0 && j == np-1 {
+			return nil, nil
+		}
+		a, b, c, d := at(i-1), at(i), at(j), at(j+1)
+		if a == d {
+			// all but one city: the same tour, reversed
+			return nil, nil
+		}
+		return []edge{newEdge(a, b), newEdge(c, d)}, []edge{newEdge(a, c), newEdge(b, d)}
+	case "swap":
+		if i == 0 && j == np-1 {
+			// adjacent around the end of the permutation
+			i, j = j, i
+		}
+		p, x, y, s := at(i-1), at(i), at(j), at(j+1)
+		if (i+1)%np == j {
+			return []edge{newEdge(p, x), newEdge(y, s)}, []edge{newEdge(p, y), newEdge(x, s)}
+		}
+		q, r := at(i+1), at(j-1)
+		switch {
+		case q == r && p == s:
+			// 4 cities: the same tour, reversed
+			return nil, nil
+		case q == r:
+			// one city between: its edges are kept
+			return []edge{newEdge(p, x), newEdge(y, s)}, []edge{newEdge(p, y), newEdge(x, s)}
+		case p == s:
+			// one city between around the end of the permutation: its edges are kept
+			return []edge{newEdge(x, q), newEdge(r, y)}, []edge{newEdge(y, q), newEdge(r, x)}
+		}
+		return []edge{newEdge(p, x), newEdge(x, q), newEdge(r, y), newEdge(y, s)},
+			[]edge{newEdge(p, y), newEdge(y, q), newEdge(r, x), newEdge(x, s)}
+	}
+	return nil, nil
+}
+
+func (w tspWalker) tabuSearch(results chan<- packet) {
+
+	prob := w.problem
+	par := w.param
+	npoints := prob.dist.size()
+
+	prop := w.newProposer()
+	mix := w.moves.newState()
+	idx := make([]int, w.moves.arity())
+	tabu := make(map[edge]int) // iteration until which an edge may not be added
+
+	energy := travelDist(w.state, prob.dist)
+	best_e := energy
+	best_s := make([]int, npoints)
+	copy(best_s, w.state)
+	result_ct := 0
+
+	// best admissible move found in an iteration
+	var bestK, bestI, bestJ int
+	var bestD float64
+	var found bool
+	pair := make([]int, 2)
+	consider := func(iter int, k int, i int, j int) {
+		mc := w.moves.classes[k]
+		pair[0], pair[1] = i, j
+		d := mc.delta(pair, w.state, prob.dist)
+		if found && d >= bestD {
+			return
+		}
+		_, added := moveEdges(mc.name, i, j, w.state)
+		if added == nil {
+			return
+		}
+		if energy+d >= best_e {
+			for _, e := range added {
+				if tabu[e] > iter {
+					return
+				}
+			}
+		}
+		bestK, bestI, bestJ, bestD, found = k, i, j, d, true
+	}
+
+	start := time.Now()
+	for iter := 1; iter < par.maxIter; iter++ {
+
+		found = false
+		if par.candidates > 0 {
+			for c := 0; c < par.candidates; c++ {
+				k := mix.choose()
+				ix := idx[:w.moves.classes[k].arity]
+				prop.propose(ix, w.moves.classes[k].variants)
+				consider(iter, k, ix[0], ix[1])
+			}
+		} else {
+			for k := range w.moves.classes {
+				for i := 0; i < npoints; i++ {
+					for j := i + 1; j < npoints; j++ {
+						consider(iter, k, i, j)
+					}
+				}
+			}
+		}
+		if !found {
+			// every move tabu
+			result_ct++
+			if result_ct >= par.countdown {
+				break
+			}
+			continue
+		}
+
+		// make the move, and make its removed edges tabu
+		mc := w.moves.classes[bestK]
+		removed, _ := moveEdges(mc.name, bestI, bestJ, w.state)
+		for _, e := range removed {
+			tabu[e] = iter + par.tenure
+		}
+		ix := []int{bestI, bestJ}
+		mc.move(ix, w.state)
+		prop.update(ix, mc.variants)
+		energy += bestD
+		if energy < best_e-1e-9 {
+			best_e = energy
+			copy(best_s, w.state)
+			result_ct = 0
+		} else {
+			result_ct++
+		}
+		if result_ct >= par.countdown {
+			break
+		}
+
+		// report progress, and drop expired tabu edges
+		if iter%par.period == 0 {
+			if w.verbose {
+				fmt.Printf("%6d: dist %v best dist %v tabu edges %d\n", iter, energy, best_e, len(tabu))
+			}
+			for e, until := range tabu {
+				if until <= iter {
+					delete(tabu, e)
+				}
+			}
+		}
+	}
+	runtime := time.Since(start)
+	fmt.Printf("Found distance %v in time %v\n", travelDist(best_s, prob.dist), runtime)
+
+	// send data packet back to client
+	var res packet
+	res.best_s = make([]int, npoints)
+	res.id = w.id
+	res.best_e = best_e
+	copy(res.best_s, best_s)
+	results <- res
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+/*
+Automatic temperature estimation from the positive energy deltas of random
+proposals at the walker's starting state.
+
+Initial temperature: Ben-Ameur's iterative method (Computational Optimization and
+Applications 29, 2004) for a target acceptance ratio chi0 of uphill moves,
+
+	chi(T) = mean exp(-delta/T),    T <- T (ln chi(T) / ln chi0)
+
+Final temperature: the temperature at which the smallest positive deltas (the
+lowest percentile) are accepted with probability chiF.
+*/
+
+const autoSamples = 10000 // nr proposals sampled for automatic temperatures
+
+// set the automatic temperatures of par, estimated at the walker's state: the
+// initial temperature if 0, and the final temperature if 0 and wanted (e.g. by
+// the schedule)
+func (w tspWalker) autoTemperature(par *annealParam, chi0 float64, chiF float64, final bool) error {
+
+	if chi0 <= 0 || chi0 >= 1 || chiF <= 0 || chiF >= 1 {
+		return fmt.Errorf("target acceptances chi0 %v and chif %v must be between 0 and 1", chi0, chiF)
+	}
+	final = final && par.tempFinal <= 0
+	if par.temperature > 0 && !final {
+		return nil
+	}
+	t0, tf, err := w.estimateTemperature(chi0, chiF, autoSamples)
+	if err != nil {
+		return err
+	}
+	if par.temperature <= 0 {
+		par.temperature = t0
+		fmt.Printf("Initial temperature %v (uphill acceptance %v)\n", t0, chi0)
+	}
+	if final {
+		par.tempFinal = tf
+		fmt.Printf("Final temperature %v (uphill acceptance %v)\n", tf, chiF)
+	}
+	return nil
+}
+
+// whether the schedule of par cools to its final temperature
+func usesTempFinal(par annealParam) bool {
+	return par.schedule == "linear" || (par.schedule == "exp" && par.alpha <= 0)
+}
+
+func (w tspWalker) estimateTemperature(chi0 float64, chiF float64, nsamples int) (float64, float64, error) {
+
+	prob := w.problem
+	idx := make([]int, w.moves.arity())
+	mix := w.moves.newState()
+	prop := w.newProposer()
+
+	// sample positive deltas
+	var deltas []float64
+	for s := 0; s < nsamples; s++ {
+		mc := w.moves.classes[mix.choose()]
+		ix := idx[:mc.arity]
+		prop.propose(ix, mc.variants)
+		if d := mc.delta(ix, w.state, prob.dist); d > 0 {
+			deltas = append(deltas, d)
+		}
+	}
+	if len(deltas) == 0 {
+		return 0.0, 0.0, fmt.Errorf("no uphill moves in %d proposals: give the temperature", nsamples)
+	}
+
+	// initial temperature
+	mean := 0.0
+	for _, d := range deltas {
+		mean += d
+	}
+	mean /= float64(len(deltas))
+	t0 := -mean / math.Log(chi0)
+	for it := 0; it < 100; it++ {
+		chi := 0.0
+		for _, d := range deltas {
+			chi += math.Exp(-d / t0)
+		}
+		chi /= float64(len(deltas))
+		if math.Abs(chi-chi0) < 1e-4 || chi == 0 {
+			break
+		}
+		t0 *= math.Log(chi) / math.Log(chi0)
+	}
+
+	// final temperature
+	sort.Float64s(deltas)
+	small := deltas[len(deltas)/100]
+	tf := -small / math.Log(chiF)
+
+	return t0, tf, nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/*
+Parallel tempering (replica exchange):
+
+- one replica per walker, each holding a rung of a fixed temperature ladder
+- each round, replicas run one period of Metropolis moves in parallel (go routines)
+- then Metropolis swaps are attempted between neighbouring rungs (even pairs and
+  odd pairs in alternate rounds)
+- geometric ladder from the hottest to the coldest temperature, or adaptive:
+  every adaptEvery rounds the log-temperature gaps are re-spread so as to
+  equalise the exchange rates, keeping the end temperatures fixed
+- each round every replica sends a packet (its rung, and whether it was exchanged),
+  with the best state found by that replica
+*/
+
+const (
+	adaptEvery = 10  // rounds between ladder adaptations
+	adaptGain  = 2.0 // gap factor exp(gain (rate - mean rate))
+)
+
+// a Metropolis walker with its running state
+type replica struct {
+	w      tspWalker
+	idx    []int
+	mix    *mixState
+	prop   *proposer
+	energy float64
+	best_e float64
+	best_s []int
+}
+
+func (w tspWalker) newReplica() *replica {
+
+	rp := replica{
+		w:      w,
+		idx:    make([]int, w.moves.arity()),
+		mix:    w.moves.newState(),
+		prop:   w.newProposer(),
+		energy: travelDist(w.state, w.problem.dist),
+		best_s: make([]int, len(w.state))}
+	rp.best_e = rp.energy
+	copy(rp.best_s, w.state)
+	return &rp
+}
+
+// run a period at fixed temperature, returning sampled energies and acceptance
+func (rp *replica) run(temperature float64) ([]float64, float64) {
+
+	w := rp.w
+	par := w.param
+	var energies []float64
+	acceptance := 0
+	for iter := 0; iter < par.period; iter++ {
+
+		k := rp.mix.choose()
+		mc := w.moves.classes[k]
+		ix := rp.idx[:mc.arity]
+		rp.prop.propose(ix, mc.variants)
+		delta_d := mc.delta(ix, w.state, w.problem.dist)
+		accept := metropolis{}.accept(delta_d, rp.energy, rp.best_e, temperature)
+		if accept {
+			mc.move(ix, w.state)
+			rp.prop.update(ix, mc.variants)
+			rp.energy += delta_d
+			acceptance++
+			if rp.energy < rp.best_e {
+				rp.best_e = rp.energy
+				copy(rp.best_s, w.state)
+			}
+		}
+		rp.mix.record(k, accept, delta_d)
+		if par.srate > 0 && iter%par.srate == 0 {
+			energies = append(energies, rp.energy)
+		}
+	}
+	return energies, float64(acceptance) / float64(par.period)
+}
+
+// geometric ladder from hot to cold
+func geometricLadder(hot float64, cold float64, n int) []float64 {
+
+	ladder := make([]float64, n)
+	for r := range ladder {
+		if n == 1 {
+			ladder[r] = hot
+		} else {
+			ladder[r] = hot * math.Pow(cold/hot, float64(r)/float64(n-1))
+		}
+	}
+	return ladder
+}
+
+// re-spread log-temperature gaps to equalise exchange rates
+func adaptLadder(ladder []float64, rates []float64) {
+
+	n := len(ladder)
+	if n < 3 {
+		return
+	}
+	mean := 0.0
+	for _, r := range rates {
+		mean += r
+	}
+	mean /= float64(n - 1)
+	gaps := make([]float64, n-1)
+	total, sum := 0.0, 0.0
+	for r := range gaps {
+		gaps[r] = math.Log(ladder[r] / ladder[r+1])
+		total += gaps[r]
+		// low exchange rate: close the gap
+		gaps[r] *= math.Exp(adaptGain * (rates[r] - mean))
+		sum += gaps[r]
+	}
+	for r := range gaps {
+		ladder[r+1] = ladder[r] * math.Exp(-gaps[r]*total/sum)
+	}
+}
+
+func parallelTempering(walkers []tspWalker, ladder []float64, adaptive bool, numJobs int, results chan<- packet) {
+
+	nr := len(walkers)
+	replicas := make([]*replica, nr)
+	for r := range replicas {
+		replicas[r] = walkers[r].newReplica()
+	}
+	// replica at each rung, and exchange counts per pair of rungs
+	rung := make([]int, nr)
+	for r := range rung {
+		rung[r] = r
+	}
+	attempts := make([]int, nr-1)
+	accepts := make([]int, nr-1)
+	blockAttempts := make([]int, nr-1)
+	blockAccepts := make([]int, nr-1)
+
+	start := time.Now()
+	for job := 0; job < numJobs; job++ {
+
+		// run all replicas at their temperatures
+		energies := make([][]float64, nr)
+		acceptance := make([]float64, nr)
+		var wg sync.WaitGroup
+		for r := 0; r < nr; r++ {
+			wg.Add(1)
+			go func(r int) {
+				defer wg.Done()
+				energies[rung[r]], acceptance[rung[r]] = replicas[rung[r]].run(ladder[r])
+			}(r)
+		}
+		wg.Wait()
+
+		// attempt exchanges between neighbouring rungs
+		exchanged := make([]bool, nr)
+		for r := job % 2; r < nr-1; r += 2 {
+			a, b := replicas[rung[r]], replicas[rung[r+1]]
+			attempts[r]++
+			blockAttempts[r]++
+			x := (1/ladder[r] - 1/ladder[r+1]) * (a.energy - b.energy)
+			if x >= 0 || rand.Float64() < math.Exp(x) {
+				rung[r], rung[r+1] = rung[r+1], rung[r]
+				accepts[r]++
+				blockAccepts[r]++
+				exchanged[rung[r]], exchanged[rung[r+1]] = true, true
+			}
+		}
+
+		// report each replica
+		for r := 0; r < nr; r++ {
+			rp := replicas[rung[r]]
+			var res packet
+			res.id = rp.w.id
+			res.temperature = ladder[r]
+			res.rung = r
+			res.exchanged = exchanged[rp.w.id]
+			res.energy = energies[rp.w.id]
+			res.acceptance = rp.mix.acceptance()
+			res.best_e = rp.best_e
+			res.best_s = make([]int, len(rp.best_s))
+			copy(res.best_s, rp.best_s)
+			rp.mix.endPeriod()
+			results <- res
+			if rp.w.verbose {
+				fmt.Printf("%2d %4d: rung %d temperature %v, acceptance %v best dist %v\n",
+					rp.w.id, job, r, ladder[r], acceptance[rp.w.id], rp.best_e)
+			}
+		}
+
+		// adapt ladder
+		if adaptive && (job+1)%adaptEvery == 0 {
+			rates := make([]float64, nr-1)
+			for r := range rates {
+				if blockAttempts[r] > 0 {
+					rates[r] = float64(blockAccepts[r]) / float64(blockAttempts[r])
+				}
+				blockAttempts[r], blockAccepts[r] = 0, 0
+			}
+			adaptLadder(ladder, rates)
+		}
+	}
+	runtime := time.Since(start)
+
+	// report
+	best_e := replicas[0].best_e
+	for _, rp := range replicas {
+		best_e = math.Min(best_e, rp.best_e)
+	}
+	fmt.Printf("Parallel tempering: found distance %v in time %v\n", best_e, runtime)
+	for r := 0; r < nr-1; r++ {
+		rate := 0.0
+		if attempts[r] > 0 {
+			rate = float64(accepts[r]) / float64(attempts[r])
+		}
+		fmt.Printf("  exchange %d-%d (T %.6g-%.6g): %d/%d = %.4f\n",
+			r, r+1, ladder[r], ladder[r+1], accepts[r], attempts[r], rate)
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"bufio"
+	"fmt"
 	"math"
+	"math/rand"
 	"os"
 	"strconv"
 	"strings"
@@ -20,12 +22,26 @@ func makePolygon(n int) tspProblem {
 		prob.labels = append(prob.labels, strconv.Itoa(i))
 		prob.points = append(prob.points, pt)
 	}
-	prob.dist = distMatrix(prob.points)
+	prob.setMetric("euclid")
+	return prob
+}
+
+// n cities at random in the unit square
+func makeRandom(n int) tspProblem {
+
+	var prob tspProblem
+
+	for i := 0; i < n; i++ {
+		pt := [2]float64{rand.Float64(), rand.Float64()}
+		prob.labels = append(prob.labels, strconv.Itoa(i))
+		prob.points = append(prob.points, pt)
+	}
+	prob.setMetric("euclid")
 	return prob
 }
 
 // read data file into points slice
-func readCsv(dataFile string) tspProblem {
+func readCsv(dataFile string, metricName string) tspProblem {
 
 	var prob tspProblem
 	df, _ := os.Open(dataFile)
@@ -43,6 +59,230 @@ func readCsv(dataFile string) tspProblem {
 		pt := [2]float64{x, y}
 		prob.points = append(prob.points, pt)
 	}
-	prob.dist = distMatrix(prob.points)
+	prob.setMetric(metricName)
 	return prob
 }
+
+// read a CSV of distances between cities by label, with header from,to,distance:
+// a row per ordered pair of cities, where a missing reverse row means the same
+// distance both ways
+func readArcsCsv(dataFile string) (tspProblem, error) {
+
+	var prob tspProblem
+	df, err := os.Open(dataFile)
+	if err != nil {
+		return prob, err
+	}
+	defer df.Close()
+
+	index := make(map[string]int)
+	city := func(label string) int {
+		label = strings.TrimSpace(label)
+		k, ok := index[label]
+		if !ok {
+			k = len(prob.labels)
+			index[label] = k
+			prob.labels = append(prob.labels, label)
+		}
+		return k
+	}
+	type arc struct {
+		from, to int
+		d        float64
+	}
+	var arcs []arc
+	scanner := bufio.NewScanner(df)
+	scanner.Scan() // this skips the header
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		record := strings.Split(line, ",")
+		if len(record) < 3 {
+			return prob, fmt.Errorf("%s: bad line %q", dataFile, line)
+		}
+		d, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if err != nil {
+			return prob, fmt.Errorf("%s: bad distance in %q", dataFile, line)
+		}
+		arcs = append(arcs, arc{city(record[0]), city(record[1]), d})
+	}
+	if err := scanner.Err(); err != nil {
+		return prob, err
+	}
+
+	n := len(prob.labels)
+	dist := make(denseDist, n)
+	given := make([][]bool, n)
+	for i := range dist {
+		dist[i] = make([]float64, n)
+		given[i] = make([]bool, n)
+	}
+	for _, a := range arcs {
+		dist[a.from][a.to] = a.d
+		given[a.from][a.to] = true
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			switch {
+			case i == j || given[i][j]:
+			case given[j][i]:
+				dist[i][j] = dist[j][i]
+			default:
+				return prob, fmt.Errorf("%s: no distance from %s to %s", dataFile, prob.labels[i], prob.labels[j])
+			}
+		}
+		dist[i][i] = 0.0
+	}
+	prob.dist = dist
+	prob.metric = "explicit"
+	prob.asymmetric = !isSymmetric(dist)
+	return prob, nil
+}
+
+// an error if the problem is asymmetric, for methods assuming d(a,b) = d(b,a)
+func checkSymmetric(prob tspProblem, method string) error {
+
+	if prob.asymmetric {
+		return fmt.Errorf("%s needs a symmetric distance", method)
+	}
+	return nil
+}
+
+// read problem file, detecting the format: TSPLIB, CSV (label,x,y) or CSV of
+// distances (from,to,distance). The metric defaults to the file's (TSPLIB) or
+// Euclidean (CSV) if metricName is empty.
+func readProblem(dataFile string, metricName string) (tspProblem, error) {
+
+	if metricName != "" {
+		if _, err := getMetric(metricName); err != nil {
+			return tspProblem{}, err
+		}
+	}
+	df, err := os.Open(dataFile)
+	if err != nil {
+		return tspProblem{}, err
+	}
+	scanner := bufio.NewScanner(df)
+	isTsplib := strings.HasSuffix(dataFile, ".tsp") || strings.HasSuffix(dataFile, ".atsp")
+	isArcs := false
+	for !isTsplib && scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		key, _, found := strings.Cut(line, ":")
+		isTsplib = found && isTsplibKeyword(key)
+		isArcs = strings.HasPrefix(strings.ToLower(line), "from,to")
+		break
+	}
+	df.Close()
+
+	if isTsplib {
+		return readTsplib(dataFile, metricName)
+	}
+	if isArcs {
+		if metricName != "" {
+			return tspProblem{}, fmt.Errorf("%s: explicit distances, cannot use metric %s", dataFile, metricName)
+		}
+		return readArcsCsv(dataFile)
+	}
+	if metricName == "" {
+		metricName = "euclid"
+	}
+	return readCsv(dataFile, metricName), nil
+}
+
+// read a known (e.g. published optimal) tour for the problem: a TSPLIB tour,
+// or a route file as written by writePerm
+func readProblemTour(tourFile string, prob tspProblem) ([]int, error) {
+
+	var tour []int
+	var err error
+	if isRouteFile(tourFile) {
+		tour, err = readPerm(tourFile)
+	} else {
+		tour, err = readTour(tourFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = validateTour(tour, prob.dist.size()); err != nil {
+		return nil, fmt.Errorf("%s: %v", tourFile, err)
+	}
+	return tour, nil
+}
+
+func isFile(fileName string) bool {
+
+	info, err := os.Stat(fileName)
+	return err == nil && !info.IsDir()
+}
+
+// a route file starts with the line "route"
+func isRouteFile(fileName string) bool {
+
+	df, err := os.Open(fileName)
+	if err != nil {
+		return false
+	}
+	defer df.Close()
+	scanner := bufio.NewScanner(df)
+	return scanner.Scan() && strings.TrimSpace(scanner.Text()) == "route"
+}
+
+// read a route file (0-up indices after the "route" header)
+func readPerm(fileName string) ([]int, error) {
+
+	df, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer df.Close()
+
+	var perm []int
+	scanner := bufio.NewScanner(df)
+	scanner.Scan() // this skips the header
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		j, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad index %q", fileName, line)
+		}
+		perm = append(perm, j)
+	}
+	return perm, scanner.Err()
+}
+
+// set the metric by name and compute distances
+func (prob *tspProblem) setMetric(name string) error {
+
+	m, err := getMetric(name)
+	if err != nil {
+		return err
+	}
+	if prob.points == nil {
+		return fmt.Errorf("metric %s needs point coordinates", name)
+	}
+	prob.metric = name
+	prob.dist = newDistOracle(prob.points, m)
+	return nil
+}
+
+// the city of a given label ("": none, -1)
+func (prob tspProblem) cityIndex(label string) (int, error) {
+
+	if label == "" {
+		return -1, nil
+	}
+	for k, l := range prob.labels {
+		if l == label {
+			return k, nil
+		}
+	}
+	return -1, fmt.Errorf("no city labelled %q", label)
+}
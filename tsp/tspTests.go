@@ -13,18 +13,22 @@ func (w tspWalker) testDelta(tolerance float64) int {
 	par := w.param
 
 	errCount := 0
-	npoints := len(prob.dist)
+	idx := make([]int, w.moves.arity())
+	mix := w.moves.newState()
+	prop := w.newProposer()
 	for iter := 0; iter < par.maxIter; iter++ {
 
 		old_d := travelDist(w.state, prob.dist)
-		i := rand.Intn(npoints)
-		j := rand.Intn(npoints)
-		delta_d := w.delta(i, j, w.state, prob.dist)
-		w.move(i, j, w.state)
+		mc := w.moves.classes[mix.choose()]
+		ix := idx[:mc.arity]
+		prop.propose(ix, mc.variants)
+		delta_d := mc.delta(ix, w.state, prob.dist)
+		mc.move(ix, w.state)
+		prop.update(ix, mc.variants)
 		new_d := travelDist(w.state, prob.dist)
 		// print errors
 		if math.Abs(old_d+delta_d-new_d) > tolerance {
-			fmt.Println(old_d, i, j, delta_d, new_d)
+			fmt.Println(old_d, idx, delta_d, new_d)
 			errCount++
 		}
 	}
@@ -35,15 +39,18 @@ func (w tspWalker) testDelta(tolerance float64) int {
 
 func (w tspWalker) timeMove() time.Duration {
 
-	prob := w.problem
 	par := w.param
 
-	npoints := len(prob.dist)
+	idx := make([]int, w.moves.arity())
+	mix := w.moves.newState()
+	prop := w.newProposer()
 	start := time.Now()
 	for iter := 0; iter < par.maxIter; iter++ {
-		i := rand.Intn(npoints)
-		j := rand.Intn(npoints)
-		w.move(i, j, w.state)
+		mc := w.moves.classes[mix.choose()]
+		ix := idx[:mc.arity]
+		prop.propose(ix, mc.variants)
+		mc.move(ix, w.state)
+		prop.update(ix, mc.variants)
 	}
 	runtime := time.Since(start)
 	fmt.Printf("%d moves in time %v\n", par.maxIter, runtime)
@@ -55,12 +62,15 @@ func (w tspWalker) timeDelta() time.Duration {
 	prob := w.problem
 	par := w.param
 
-	npoints := len(prob.dist)
+	idx := make([]int, w.moves.arity())
+	mix := w.moves.newState()
+	prop := w.newProposer()
 	start := time.Now()
 	for iter := 0; iter < par.maxIter; iter++ {
-		i := rand.Intn(npoints)
-		j := rand.Intn(npoints)
-		w.delta(i, j, w.state, prob.dist)
+		mc := w.moves.classes[mix.choose()]
+		ix := idx[:mc.arity]
+		prop.propose(ix, mc.variants)
+		mc.delta(ix, w.state, prob.dist)
 	}
 	runtime := time.Since(start)
 	fmt.Printf("%d delta comps in time %v\n", par.maxIter, runtime)
@@ -72,15 +82,72 @@ func (w tspWalker) timeEnergy() time.Duration {
 	prob := w.problem
 	par := w.param
 
-	npoints := len(prob.dist)
+	idx := make([]int, w.moves.arity())
+	mix := w.moves.newState()
+	prop := w.newProposer()
 	start := time.Now()
 	for iter := 0; iter < par.maxIter; iter++ {
-		i := rand.Intn(npoints)
-		j := rand.Intn(npoints)
-		w.move(i, j, w.state)
+		mc := w.moves.classes[mix.choose()]
+		ix := idx[:mc.arity]
+		prop.propose(ix, mc.variants)
+		mc.move(ix, w.state)
+		prop.update(ix, mc.variants)
 		travelDist(w.state, prob.dist)
 	}
 	runtime := time.Since(start)
 	fmt.Printf("%d move+energy comps in time %v\n", par.maxIter, runtime)
 	return runtime
 }
+
+// anneal with the walker's parameters, and check that the optimum is reached
+func (w tspWalker) testOptimum(opt_e float64, tolerance float64) bool {
+
+	results := make(chan packet, 1)
+	w.search(results)
+	res := <-results
+	ok := res.best_e <= opt_e+tolerance
+	fmt.Printf("Annealing found %v, optimum %v: reached %v\n", res.best_e, opt_e, ok)
+	return ok
+}
+
+// check the edges removed and added by reverse and swap moves (tabu.go) on a
+// random tour of n cities, for all index pairs
+func testMoveEdges(n int) int {
+
+	tourEdges := func(perm []int) map[edge]bool {
+		edges := make(map[edge]bool)
+		for k := range perm {
+			edges[newEdge(perm[k], perm[(k+1)%len(perm)])] = true
+		}
+		return edges
+	}
+	errCount, count := 0, 0
+	perm := rand.Perm(n)
+	for _, name := range []string{"reverse", "swap"} {
+		mc, _ := getMoveClass(name)
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				removed, added := moveEdges(name, i, j, perm)
+				after := make([]int, n)
+				copy(after, perm)
+				mc.move([]int{i, j}, after)
+				old, new := tourEdges(perm), tourEdges(after)
+				ok := true
+				for _, e := range removed {
+					ok = ok && old[e] && !new[e]
+				}
+				for _, e := range added {
+					ok = ok && new[e] && !old[e]
+				}
+				if !ok {
+					fmt.Println(name, i, j, removed, added)
+					errCount++
+				}
+				count++
+			}
+		}
+	}
+
+	fmt.Printf("Found %d move edge errors out of %d\n", errCount, count)
+	return errCount
+}
@@ -2,16 +2,15 @@ package main
 
 import (
 	"fmt"
-	"math"
-	"math/rand"
 	"time"
 )
 
 /*
 Metropolis search - returns best energy and best state.
 
-- pluggable cooling schedule
-- stopping criterion by repetition countdown for best energy
+- pluggable cooling schedule (schedule.go) and acceptance rule (acceptor.go)
+- stopping criterion by repetition countdown for best energy, or wall-clock budget
+- optional reheating on stagnation (reheat "best", "current" or "restart")
 - fast er than explore() with no data collection
 - run parallel walkers as go routines
 */
@@ -19,19 +18,22 @@ func (w tspWalker) search(results chan<- packet) {
 
 	prob := w.problem
 	par := w.param
-	npoints := len(prob.points)
+	npoints := prob.dist.size()
 
-	is_sigmage := (par.schedule == "sigmage")
-	result_ct, bin_ct := 0, 0
-	sigmage_wait := 2 // waiting time to cool under sigmage schedule
+	result_ct := 0
+	t0 := par.temperature
+	reheats, iter0 := 0, 0 // nr reheats, iteration of the last
 
 	// to track progress
+	idx := make([]int, w.moves.arity())
+	mix := w.moves.newState()
+	prop := w.newProposer()
 	acceptance := 0
 	energy := travelDist(w.state, prob.dist)
 	best_e := travelDist(w.state, prob.dist)
+	sched, acc := walkerRules(par, energy)
 	lastBest := 2 * best_e
-	mean_e, previous_mean := 0.0, 0.0
-	sd2_e, previous_sd2 := 0.0, 0.0
+	var stats energyStats
 	// to track the best state, make a new slice and copy perm into it:
 	best_s := make([]int, npoints)
 	copy(best_s, w.state)
@@ -39,12 +41,16 @@ func (w tspWalker) search(results chan<- packet) {
 	start := time.Now()
 	for iter := 1; iter < par.maxIter; iter++ {
 
-		i := rand.Intn(npoints)
-		j := rand.Intn(npoints)
-		delta_d := w.delta(i, j, w.state, prob.dist)
-		if delta_d < 0 || rand.Float64() < math.Exp(-delta_d/par.temperature) {
+		k := mix.choose()
+		mc := w.moves.classes[k]
+		ix := idx[:mc.arity]
+		prop.propose(ix, mc.variants)
+		delta_d := mc.delta(ix, w.state, prob.dist)
+		accept := acc.accept(delta_d, energy, best_e, par.temperature)
+		if accept {
 			// accept proposal
-			w.move(i, j, w.state)
+			mc.move(ix, w.state)
+			prop.update(ix, mc.variants)
 			acceptance += 1
 			energy += delta_d
 			if energy < best_e {
@@ -52,21 +58,26 @@ func (w tspWalker) search(results chan<- packet) {
 				copy(best_s, w.state)
 			}
 		}
+		mix.record(k, accept, delta_d)
 		// update stats
-		if is_sigmage {
-			mean_e += energy
-			sd2_e += energy * energy
-		}
+		stats.add(energy)
 
 		// report progress
 		if iter%par.period == 0 {
+			if par.budget > 0 && time.Since(start) > par.budget {
+				break
+			}
 			if w.verbose {
 				fmt.Printf("%6d: temperature %v, acceptance %v best dist %v\n",
 					iter,
 					par.temperature,
 					float64(acceptance)/float64(par.period),
 					best_e)
+				if len(w.moves.classes) > 1 {
+					fmt.Printf("        %v\n", mix)
+				}
 			}
+			mix.endPeriod()
 			// check countdown
 			if best_e == lastBest {
 				result_ct++
@@ -74,28 +85,46 @@ func (w tspWalker) search(results chan<- packet) {
 				lastBest = best_e
 				result_ct = 0
 			}
-			if result_ct >= par.countdown {
-				break
-			}
-			// otherwise proceed to cooler temperature
-			if is_sigmage {
-				mean_e /= float64(par.period)
-				sd2_e /= float64(par.period)
-				sd2_e -= mean_e * mean_e
-				if (mean_e-previous_mean)*(mean_e-previous_mean) < 2*previous_sd2 {
-					bin_ct++
+			if par.reheat != "" && result_ct >= par.stagnation && reheats < par.maxReheats {
+				// reheat from the best or current state, on a fresh schedule
+				reheats++
+				result_ct = 0
+				iter0 = iter
+				if par.reheat != "current" {
+					copy(w.state, best_s)
+					energy = best_e
+					prop = w.newProposer()
+				}
+				if par.reheat == "restart" {
+					par.temperature = t0
 				} else {
-					bin_ct = 0
+					par.temperature = par.reheatFrac * t0
+				}
+				par.nperiods = (par.maxIter - iter) / par.period
+				var err error
+				if sched, err = newSchedule(par); err != nil {
+					// e.g. no periods left for a linear schedule
+					fmt.Printf("%6d: no reheat (%v)\n", iter, err)
+					break
 				}
-				if bin_ct >= sigmage_wait {
-					par.temperature *= par.cooling
+				if par.acceptor == "deluge" {
+					// a fresh water level, falling over the remaining iterations
+					rest := par
+					rest.maxIter = par.maxIter - iter
+					if acc, err = newAcceptor(rest, energy); err != nil {
+						fmt.Printf("%6d: no reheat (%v)\n", iter, err)
+						break
+					}
 				}
-				previous_mean = mean_e
-				previous_sd2 = sd2_e
-				mean_e = 0.0
-				sd2_e = 0.0
+				stats = energyStats{}
+				if w.verbose {
+					fmt.Printf("%6d: reheat %d (%s) to temperature %v\n", iter, reheats, par.reheat, par.temperature)
+				}
+			} else if result_ct >= par.countdown {
+				break
 			} else {
-				par.temperature *= par.cooling
+				// otherwise proceed to cooler temperature
+				par.temperature = sched.next(par.temperature, stats.period((iter-iter0)/par.period, acceptance, best_e))
 			}
 			// reset variables
 			acceptance = 0
@@ -118,7 +147,7 @@ func (w tspWalker) search(results chan<- packet) {
 /*
 Explore routine:
 
-- flat cooling schedule only
+- pluggable cooling schedule, one step per period, and acceptance rule
 - specified number of constant-temperature periods
 - burn-in before data collection in each period
 - data collection and piping to client
@@ -130,12 +159,17 @@ func (w tspWalker) explore(numJobs int, results chan<- packet) {
 	// set-up
 	prob := w.problem
 	par := w.param
-	npoints := len(prob.points)
+	npoints := prob.dist.size()
 
 	// to track progress
+	idx := make([]int, w.moves.arity())
+	mix := w.moves.newState()
+	prop := w.newProposer()
+	var stats energyStats
 	acceptance := 0
 	energy := travelDist(w.state, prob.dist)
 	best_e := travelDist(w.state, prob.dist)
+	sched, acc := walkerRules(par, energy)
 
 	// to track the best state, make a new slice and copy initial state into it:
 	best_s := make([]int, npoints)
@@ -156,15 +190,20 @@ func (w tspWalker) explore(numJobs int, results chan<- packet) {
 		for iter := 0; iter < par.period; iter++ {
 
 			{ // MOVE BLOCK
-				i := rand.Intn(npoints)
-				j := rand.Intn(npoints)
-				delta_d := w.delta(i, j, w.state, prob.dist)
-				if delta_d < 0 || rand.Float64() < math.Exp(-delta_d/par.temperature) {
+				k := mix.choose()
+				mc := w.moves.classes[k]
+				ix := idx[:mc.arity]
+				prop.propose(ix, mc.variants)
+				delta_d := mc.delta(ix, w.state, prob.dist)
+				accept := acc.accept(delta_d, energy, best_e, par.temperature)
+				if accept {
 					// accept proposal
-					w.move(i, j, w.state)
+					mc.move(ix, w.state)
+					prop.update(ix, mc.variants)
 					energy += delta_d
 					acceptance++
 				}
+				mix.record(k, accept, delta_d)
 				// update best found
 				if energy < best_e {
 					best_e = energy
@@ -173,6 +212,7 @@ func (w tspWalker) explore(numJobs int, results chan<- packet) {
 			} // END OF MOVE BLOCK
 
 			// sample energy
+			stats.add(energy)
 			if iter%par.srate == 0 {
 				energies = append(energies, energy)
 			}
@@ -182,6 +222,7 @@ func (w tspWalker) explore(numJobs int, results chan<- packet) {
 		res.id = w.id
 		res.temperature = par.temperature
 		res.energy = energies
+		res.acceptance = mix.acceptance()
 		res.best_e = best_e
 		copy(res.best_s, best_s)
 		ct += len(energies)
@@ -195,10 +236,14 @@ func (w tspWalker) explore(numJobs int, results chan<- packet) {
 				par.temperature,
 				float64(acceptance)/float64(par.period),
 				best_e)
+			if len(w.moves.classes) > 1 {
+				fmt.Printf("        %v\n", mix)
+			}
 		}
+		mix.endPeriod()
 
 		// cool
-		par.temperature *= par.cooling
+		par.temperature = sched.next(par.temperature, stats.period(job+1, acceptance, best_e))
 
 		// reset variables
 		acceptance = 0
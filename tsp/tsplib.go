@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+Reader for TSPLIB instance files (http://comopt.ifi.uni-heidelberg.de/software/TSPLIB95/).
+
+Supported:
+- TYPE TSP, and ATSP (asymmetric, with an EXPLICIT FULL_MATRIX)
+- NODE_COORD_SECTION with EDGE_WEIGHT_TYPE EUC_2D, CEIL_2D, ATT, GEO, MAN_2D, MAX_2D
+- EDGE_WEIGHT_TYPE EXPLICIT with EDGE_WEIGHT_SECTION in any of the TSPLIB
+  EDGE_WEIGHT_FORMATs (FULL_MATRIX, UPPER_ROW, LOWER_ROW, UPPER_DIAG_ROW,
+  LOWER_DIAG_ROW and their _COL equivalents)
+- DISPLAY_DATA_SECTION for the points of an explicit instance
+
+Nodes are labelled by their TSPLIB node numbers.
+
+Tour files (.tour, .opt.tour) are read by readTour, written by writeTour (output.go).
+*/
+
+// TSPLIB metrics by EDGE_WEIGHT_TYPE
+var tsplibMetric = map[string]string{
+	"EUC_2D":  "euc2d",
+	"CEIL_2D": "ceil2d",
+	"ATT":     "att",
+	"GEO":     "geo",
+	"MAN_2D":  "man2d",
+	"MAX_2D":  "max2d",
+}
+
+// read TSPLIB .tsp file into a TSP problem - the metric is given by the file
+// unless metricName is set
+func readTsplib(dataFile string, metricName string) (tspProblem, error) {
+
+	var prob tspProblem
+	df, err := os.Open(dataFile)
+	if err != nil {
+		return prob, err
+	}
+	defer df.Close()
+
+	// header specification
+	spec := make(map[string]string)
+	var weights []float64
+	npoints := 0
+
+	scanner := bufio.NewScanner(df)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	section := ""
+	for scanner.Scan() {
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line == "EOF" {
+			break
+		}
+		// specification part: KEY : VALUE
+		if key, value, found := strings.Cut(line, ":"); found && isTsplibKeyword(key) {
+			key = strings.TrimSpace(key)
+			spec[key] = strings.TrimSpace(value)
+			if key == "DIMENSION" {
+				npoints, err = strconv.Atoi(spec[key])
+				if err != nil {
+					return prob, fmt.Errorf("%s: bad DIMENSION %q", dataFile, spec[key])
+				}
+			}
+			section = ""
+			continue
+		}
+		// data part
+		if strings.HasSuffix(line, "_SECTION") {
+			section = line
+			if npoints == 0 {
+				return prob, fmt.Errorf("%s: %s before DIMENSION", dataFile, section)
+			}
+			if section == "DISPLAY_DATA_SECTION" && (spec["EDGE_WEIGHT_TYPE"] != "EXPLICIT" || prob.points != nil) {
+				// display coordinates only stand in for explicit weights
+				// without node coordinates: skip the section otherwise
+				section = "SKIPPED_SECTION"
+			}
+			if section == "NODE_COORD_SECTION" || section == "DISPLAY_DATA_SECTION" {
+				prob.points = make([][2]float64, npoints)
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		switch section {
+		case "NODE_COORD_SECTION", "DISPLAY_DATA_SECTION":
+			if len(fields) < 3 {
+				return prob, fmt.Errorf("%s: bad coordinate line %q", dataFile, line)
+			}
+			node, err := strconv.Atoi(fields[0])
+			if err != nil || node < 1 || node > npoints {
+				return prob, fmt.Errorf("%s: bad node number in %q", dataFile, line)
+			}
+			x, errx := strconv.ParseFloat(fields[1], 64)
+			y, erry := strconv.ParseFloat(fields[2], 64)
+			if errx != nil || erry != nil {
+				return prob, fmt.Errorf("%s: bad coordinates in %q", dataFile, line)
+			}
+			prob.points[node-1] = [2]float64{x, y}
+		case "EDGE_WEIGHT_SECTION":
+			for _, f := range fields {
+				w, err := strconv.ParseFloat(f, 64)
+				if err != nil {
+					return prob, fmt.Errorf("%s: bad edge weight %q", dataFile, f)
+				}
+				weights = append(weights, w)
+			}
+		case "":
+			return prob, fmt.Errorf("%s: unexpected line %q", dataFile, line)
+		default:
+			// skip unsupported sections (e.g. FIXED_EDGES_SECTION)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return prob, err
+	}
+
+	atsp := spec["TYPE"] == "ATSP"
+	if t := spec["TYPE"]; t != "" && t != "TSP" && !atsp {
+		return prob, fmt.Errorf("%s: unsupported TYPE %s", dataFile, t)
+	}
+	if npoints == 0 {
+		return prob, fmt.Errorf("%s: no DIMENSION", dataFile)
+	}
+	for i := 1; i <= npoints; i++ {
+		prob.labels = append(prob.labels, strconv.Itoa(i))
+	}
+
+	// compute distances
+	ewt := spec["EDGE_WEIGHT_TYPE"]
+	if ewt == "EXPLICIT" {
+		if metricName != "" {
+			return prob, fmt.Errorf("%s: explicit edge weights, cannot use metric %s", dataFile, metricName)
+		}
+		prob.metric = "explicit"
+		prob.dist, err = explicitMatrix(weights, npoints, spec["EDGE_WEIGHT_FORMAT"])
+		if err != nil {
+			return prob, fmt.Errorf("%s: %v", dataFile, err)
+		}
+		prob.asymmetric = !isSymmetric(prob.dist)
+		return prob, nil
+	}
+	if atsp {
+		return prob, fmt.Errorf("%s: ATSP needs EXPLICIT edge weights", dataFile)
+	}
+	if metricName == "" {
+		var ok bool
+		if metricName, ok = tsplibMetric[ewt]; !ok {
+			return prob, fmt.Errorf("%s: unsupported EDGE_WEIGHT_TYPE %q", dataFile, ewt)
+		}
+	}
+	if prob.points == nil {
+		return prob, fmt.Errorf("%s: no NODE_COORD_SECTION", dataFile)
+	}
+	if err = prob.setMetric(metricName); err != nil {
+		return prob, fmt.Errorf("%s: %v", dataFile, err)
+	}
+	return prob, nil
+}
+
+// TSPLIB specification keywords
+func isTsplibKeyword(key string) bool {
+	switch strings.TrimSpace(key) {
+	case "NAME", "TYPE", "COMMENT", "DIMENSION", "CAPACITY",
+		"EDGE_WEIGHT_TYPE", "EDGE_WEIGHT_FORMAT", "EDGE_DATA_FORMAT",
+		"NODE_COORD_TYPE", "DISPLAY_DATA_TYPE":
+		return true
+	}
+	return false
+}
+
+// fill a distance matrix from an EDGE_WEIGHT_SECTION: symmetric unless
+// FULL_MATRIX, with zero diagonal (ATSP files often hold a large number there)
+func explicitMatrix(weights []float64, npoints int, format string) (denseDist, error) {
+
+	dist := make([][]float64, npoints)
+	for i := range dist {
+		dist[i] = make([]float64, npoints)
+	}
+
+	// row-wise formats and their column-wise equivalents (by symmetry)
+	var diag, upper bool
+	switch format {
+	case "FULL_MATRIX":
+		if len(weights) != npoints*npoints {
+			return nil, fmt.Errorf("%s needs %d weights, found %d", format, npoints*npoints, len(weights))
+		}
+		for i := 0; i < npoints; i++ {
+			copy(dist[i], weights[i*npoints:(i+1)*npoints])
+			dist[i][i] = 0.0
+		}
+		return dist, nil
+	case "UPPER_ROW", "LOWER_COL":
+		diag, upper = false, true
+	case "LOWER_ROW", "UPPER_COL":
+		diag, upper = false, false
+	case "UPPER_DIAG_ROW", "LOWER_DIAG_COL":
+		diag, upper = true, true
+	case "LOWER_DIAG_ROW", "UPPER_DIAG_COL":
+		diag, upper = true, false
+	default:
+		return nil, fmt.Errorf("unsupported EDGE_WEIGHT_FORMAT %q", format)
+	}
+
+	expected := npoints * (npoints - 1) / 2
+	if diag {
+		expected += npoints
+	}
+	if len(weights) != expected {
+		return nil, fmt.Errorf("%s needs %d weights, found %d", format, expected, len(weights))
+	}
+	k := 0
+	for i := 0; i < npoints; i++ {
+		// column range in row i
+		lo, hi := 0, i-1
+		if upper {
+			lo, hi = i+1, npoints-1
+		}
+		if diag {
+			if upper {
+				lo = i
+			} else {
+				hi = i
+			}
+		}
+		for j := lo; j <= hi; j++ {
+			dist[i][j] = weights[k]
+			dist[j][i] = weights[k]
+			k++
+		}
+		dist[i][i] = 0.0
+	}
+	return dist, nil
+}
+
+// read the first tour of a TSPLIB .tour file as a 0-up permutation
+func readTour(tourFile string) ([]int, error) {
+
+	df, err := os.Open(tourFile)
+	if err != nil {
+		return nil, err
+	}
+	defer df.Close()
+
+	var tour []int
+	dimension := 0
+	inTour, done := false, false
+	scanner := bufio.NewScanner(df)
+	for !done && scanner.Scan() {
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !inTour {
+			if line == "TOUR_SECTION" {
+				inTour = true
+			} else if key, value, found := strings.Cut(line, ":"); found && strings.TrimSpace(key) == "DIMENSION" {
+				dimension, err = strconv.Atoi(strings.TrimSpace(value))
+				if err != nil {
+					return nil, fmt.Errorf("%s: bad DIMENSION %q", tourFile, value)
+				}
+			}
+			continue
+		}
+		for _, f := range strings.Fields(line) {
+			node, err := strconv.Atoi(f)
+			if err != nil {
+				return nil, fmt.Errorf("%s: bad node %q", tourFile, f)
+			}
+			if node == -1 {
+				done = true
+				break
+			}
+			tour = append(tour, node-1)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !inTour {
+		return nil, fmt.Errorf("%s: no TOUR_SECTION", tourFile)
+	}
+	if dimension > 0 && dimension != len(tour) {
+		return nil, fmt.Errorf("%s: DIMENSION %d but tour has %d nodes", tourFile, dimension, len(tour))
+	}
+	return tour, nil
+}
+
+// check a tour is a permutation of the problem's nodes
+func validateTour(tour []int, npoints int) error {
+
+	if len(tour) != npoints {
+		return fmt.Errorf("tour has %d nodes, problem has %d", len(tour), npoints)
+	}
+	seen := make([]bool, npoints)
+	for _, v := range tour {
+		if v < 0 || v >= npoints {
+			return fmt.Errorf("tour node %d out of range 1..%d", v+1, npoints)
+		}
+		if seen[v] {
+			return fmt.Errorf("tour node %d repeated", v+1)
+		}
+		seen[v] = true
+	}
+	return nil
+}